@@ -0,0 +1,117 @@
+package addons
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/db"
+	"github.com/Scalingo/cli/env/mask"
+	"github.com/Scalingo/go-scalingo"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/errgo.v1"
+)
+
+const dashboardURL = "https://my.scalingo.com/apps/%s/resources/%s"
+
+// addonDetails completes the addon with the attributes returned by the API
+// which are not part of scalingo.Addon
+type addonDetails struct {
+	scalingo.Addon
+	Status        string    `json:"status"`
+	ProvisionedAt time.Time `json:"provisioned_at"`
+}
+
+type addonDetailsRes struct {
+	Addon addonDetails `json:"addon"`
+}
+
+func Info(app, addonID string) error {
+	c := config.ScalingoClient()
+	var res addonDetailsRes
+	err := c.ScalingoAPI().SubresourceGet("apps", app, "addons", addonID, nil, &res)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	addon := res.Addon
+
+	t := tablewriter.NewWriter(os.Stdout)
+	t.SetAutoWrapText(false)
+	data := [][]string{
+		[]string{"ID", addon.ID},
+		[]string{"Provider", providerName(&addon.Addon)},
+	}
+	if addon.Plan != nil {
+		data = append(data, []string{"Plan", fmt.Sprintf("%s (%.2f €/month)", addon.Plan.DisplayName, addon.Plan.Price)})
+	}
+	data = append(data,
+		[]string{"Status", addon.Status},
+		[]string{"Resource ID", addon.ResourceID},
+	)
+	if !addon.ProvisionedAt.IsZero() {
+		data = append(data, []string{"Created at", addon.ProvisionedAt.Format(time.RFC1123)})
+	}
+	for _, v := range data {
+		t.Append(v)
+	}
+
+	variables, err := c.VariablesListWithoutAlias(app)
+	if err != nil {
+		return errgo.Notef(err, "fail to list the environment of the application")
+	}
+	addonVariables := db.AddonVariables(&addon.Addon, variables)
+	if len(addonVariables) == 0 {
+		t.Append([]string{"Environment", ""})
+	}
+	for i, variable := range addonVariables {
+		title := ""
+		if i == 0 {
+			title = "Environment"
+		}
+		t.Append([]string{title, variable.Name + "=" + mask.Variable(mask.Patterns(config.C.ScalingoSecretPatterns), variable.Name, variable.Value)})
+	}
+
+	if db.HasBackups(&addon.Addon) {
+		t.Append([]string{"Latest backup", latestBackup(app, addon.ID)})
+	}
+	t.Append([]string{"Dashboard", fmt.Sprintf(dashboardURL, app, addon.ID)})
+	t.Render()
+	return nil
+}
+
+// Token mints a token giving access to the database API for this addon
+func Token(app, addonID string) error {
+	c := config.ScalingoClient()
+	token, err := c.AddonToken(app, addonID)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	fmt.Println(token)
+	return nil
+}
+
+func latestBackup(app, addonID string) string {
+	c := config.ScalingoClient()
+	backups, err := c.BackupList(app, addonID)
+	if err != nil {
+		return fmt.Sprintf("unavailable (%v)", err)
+	}
+	if len(backups) == 0 {
+		return "none"
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	backup := backups[0]
+	return fmt.Sprintf("%s, %s (%s)", backup.Status, humanize.Time(backup.CreatedAt), humanize.Bytes(backup.Size))
+}
+
+func providerName(addon *scalingo.Addon) string {
+	if addon.AddonProvider != nil {
+		return addon.AddonProvider.Name
+	}
+	return addon.AddonProviderID
+}
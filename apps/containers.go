@@ -0,0 +1,53 @@
+package apps
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Scalingo/cli/config"
+	httpclient "github.com/Scalingo/go-scalingo/http"
+	"gopkg.in/errgo.v1"
+)
+
+// runningContainer is a running container of an application, as opposed to the
+// container types returned by AppsPs. The client doesn't list them, the
+// request is done with its API client.
+type runningContainer struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"`
+	TypeIndex int           `json:"type_index"`
+	Label     string        `json:"label"`
+	State     string        `json:"state"`
+	Command   string        `json:"command"`
+	CreatedAt *time.Time    `json:"created_at"`
+	Size      containerSize `json:"size"`
+}
+
+type containerSize struct {
+	Name string `json:"name"`
+}
+
+type containersRes struct {
+	Containers []runningContainer `json:"containers"`
+}
+
+// FullType is the name of the container, as displayed in the logs
+func (c runningContainer) FullType() string {
+	if c.Label != "" {
+		return c.Label
+	}
+	return fmt.Sprintf("%v-%v", c.Type, c.TypeIndex)
+}
+
+func containersList(app string) ([]runningContainer, error) {
+	c := config.ScalingoClient()
+	var res containersRes
+	req := &httpclient.APIRequest{
+		Endpoint: "/apps/" + app + "/ps",
+	}
+	err := c.ScalingoAPI().DoRequest(req, &res)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	return res.Containers, nil
+}
@@ -30,39 +30,47 @@ func Logs(appName string, stream bool, n int, filter string) error {
 		return errgo.Mask(err, errgo.Any)
 	}
 
+	logsURL, err := appLogsURL(appName)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	if err = logs.Dump(logsURL, n, filter); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	if stream {
+		if err = logs.Stream(logsURL, filter); err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+	}
+	return nil
+}
+
+func appLogsURL(appName string) (string, error) {
 	c := config.ScalingoClient()
 	res, err := c.LogsURL(appName)
 	if err != nil {
-		return errgo.Mask(err, errgo.Any)
+		return "", errgo.Mask(err, errgo.Any)
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return errgo.Newf("fail to query logs: %s", res.Status)
+		return "", errgo.Newf("fail to query logs: %s", res.Status)
 	}
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return errgo.Mask(err, errgo.Any)
+		return "", errgo.Mask(err, errgo.Any)
 	}
 
 	debug.Println("[API-Response] ", string(body))
 
 	logsRes := &LogsRes{}
 	if err = json.Unmarshal(body, &logsRes); err != nil {
-		return errgo.Mask(err, errgo.Any)
-	}
-
-	if err = logs.Dump(logsRes.LogsURL, n, filter); err != nil {
-		return errgo.Mask(err, errgo.Any)
+		return "", errgo.Mask(err, errgo.Any)
 	}
-
-	if stream {
-		if err = logs.Stream(logsRes.LogsURL, filter); err != nil {
-			return errgo.Mask(err, errgo.Any)
-		}
-	}
-	return nil
+	return logsRes.LogsURL, nil
 }
 
 func checkFilter(appName string, filter string) error {
@@ -0,0 +1,286 @@
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/debug"
+	"github.com/Scalingo/cli/io"
+	"github.com/Scalingo/cli/logs"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/errgo.v1"
+)
+
+const oneOffType = "one-off"
+
+// oneOff is stored locally when a detached one-off is started, the attach
+// URL can't be fetched from the API afterwards.
+type oneOff struct {
+	App       string    `json:"app"`
+	Container string    `json:"container"`
+	Command   string    `json:"command"`
+	AttachURL string    `json:"attach_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var (
+	oneOffsFile        = filepath.Join(config.C.ConfigDir, "one-offs.json")
+	oneOffsRetention   = 7 * 24 * time.Hour
+	oneOffPollInterval = 5 * time.Second
+)
+
+func OneOffs(app string) error {
+	containers, err := containersList(app)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	saved, err := readOneOffs()
+	if err != nil {
+		debug.Println("fail to read one-offs file:", err)
+	}
+
+	t := tablewriter.NewWriter(os.Stdout)
+	t.SetHeader([]string{"Name", "Size", "State", "Started At", "Command", "Attachable"})
+
+	found := false
+	for _, ct := range containers {
+		if ct.Type != oneOffType {
+			continue
+		}
+		found = true
+
+		startedAt := "-"
+		if ct.CreatedAt != nil {
+			startedAt = ct.CreatedAt.Format(time.RFC1123)
+		}
+		attachable := "no"
+		if findOneOff(saved, app, ct.FullType()) != nil {
+			attachable = "yes"
+		}
+		t.Append([]string{ct.FullType(), ct.Size.Name, ct.State, startedAt, "`" + ct.Command + "`", attachable})
+	}
+
+	if !found {
+		fmt.Printf("There is no one-off container running for app '%s'.\n", app)
+		return nil
+	}
+	t.Render()
+	return nil
+}
+
+// RunAttach reconnects the terminal to a detached one-off container. If the
+// run service refuses the connection, the logs of the container are followed
+// until it stops.
+func RunAttach(app, containerName string) error {
+	container, err := oneOffContainer(app, containerName)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	saved, err := readOneOffs()
+	if err != nil {
+		debug.Println("fail to read one-offs file:", err)
+	}
+
+	ctx := newRunContext(app)
+	savedOneOff := findOneOff(saved, app, container.FullType())
+	if savedOneOff == nil {
+		io.Warning("The one-off has not been started from this computer, it can't be attached to.")
+		return ctx.followOneOff(container)
+	}
+	ctx.attachURL = savedOneOff.AttachURL
+
+	fmt.Fprintf(ctx.waitingTextOutputWriter, "-----> Connecting to container [%v]...  ", container.FullType())
+	attachSpinner := io.NewSpinner(ctx.waitingTextOutputWriter)
+	attachSpinner.PostHook = func() {
+		fmt.Fprintf(ctx.waitingTextOutputWriter, "\n-----> Attached to process '%v'  ", savedOneOff.Command)
+	}
+	go attachSpinner.Start()
+
+	res, socket, err := ctx.connectToRunServer()
+	if err == nil && res.StatusCode == http.StatusOK {
+		exitCode, err := ctx.attach(socket, attachSpinner)
+		if err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+		removeOneOff(app, container.FullType())
+		os.Exit(exitCode)
+	}
+
+	attachSpinner.PostHook = nil
+	attachSpinner.Stop()
+	fmt.Fprintln(ctx.waitingTextOutputWriter)
+	if err != nil {
+		debug.Println("fail to attach to the one-off:", err)
+	} else {
+		debug.Println("fail to attach to the one-off:", res.Status)
+	}
+	io.Warning("The run service does not allow to attach to this one-off.")
+	return ctx.followOneOff(container)
+}
+
+// followOneOff streams the logs of the container and waits for it to stop
+// to report its exit status.
+func (ctx *runContext) followOneOff(container *runningContainer) error {
+	url, err := appLogsURL(ctx.app)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	io.Statusf("Following the logs of %s until it stops\n\n", container.FullType())
+
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- logs.StreamUntil(url, container.FullType(), stop)
+	}()
+
+	for {
+		select {
+		case err := <-errs:
+			// The user interrupted the stream
+			if err != nil {
+				return errgo.Mask(err, errgo.Any)
+			}
+			return nil
+		case <-time.After(oneOffPollInterval):
+		}
+
+		containers, err := containersList(ctx.app)
+		if err != nil {
+			debug.Println("fail to list containers:", err)
+			continue
+		}
+		if !isContainerRunning(containers, container.ID) {
+			close(stop)
+			<-errs
+			break
+		}
+	}
+
+	removeOneOff(ctx.app, container.FullType())
+	fmt.Println()
+	if ctx.attachURL == "" {
+		io.Statusf("One-off %s has stopped, its exit status is not available.\n", container.FullType())
+		return nil
+	}
+
+	exitCode, err := ctx.exitCode()
+	if err != nil {
+		return errgo.Notef(err, "fail to get the exit status of %s", container.FullType())
+	}
+	io.Statusf("One-off %s exited with status %d\n", container.FullType(), exitCode)
+	os.Exit(exitCode)
+	return nil
+}
+
+func oneOffContainer(app, name string) (*runningContainer, error) {
+	containers, err := containersList(app)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	for _, ct := range containers {
+		if ct.Type != oneOffType {
+			continue
+		}
+		if ct.ID == name || ct.FullType() == name {
+			container := ct
+			return &container, nil
+		}
+	}
+	return nil, errgo.Newf("no one-off container named '%s' is running, see `scalingo -a %s one-offs`", name, app)
+}
+
+func isContainerRunning(containers []runningContainer, id string) bool {
+	for _, ct := range containers {
+		if ct.ID == id {
+			return ct.State != "stopped" && ct.State != "crashed"
+		}
+	}
+	return false
+}
+
+func findOneOff(oneOffs []oneOff, app, container string) *oneOff {
+	for i, o := range oneOffs {
+		if o.App == app && o.Container == container {
+			return &oneOffs[i]
+		}
+	}
+	return nil
+}
+
+func readOneOffs() ([]oneOff, error) {
+	fd, err := os.Open(oneOffsFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	defer fd.Close()
+
+	var oneOffs []oneOff
+	err = json.NewDecoder(fd).Decode(&oneOffs)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return oneOffs, nil
+}
+
+func writeOneOffs(oneOffs []oneOff) error {
+	fd, err := os.OpenFile(oneOffsFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer fd.Close()
+
+	err = json.NewEncoder(fd).Encode(oneOffs)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func saveOneOff(o oneOff) error {
+	saved, err := readOneOffs()
+	if err != nil {
+		debug.Println("invalid one-offs file, resetting it:", err)
+	}
+
+	oneOffs := []oneOff{o}
+	for _, s := range saved {
+		if time.Since(s.CreatedAt) > oneOffsRetention {
+			continue
+		}
+		if s.App == o.App && s.Container == o.Container {
+			continue
+		}
+		oneOffs = append(oneOffs, s)
+	}
+	return writeOneOffs(oneOffs)
+}
+
+func removeOneOff(app, container string) {
+	saved, err := readOneOffs()
+	if err != nil {
+		debug.Println("fail to read one-offs file:", err)
+		return
+	}
+
+	var oneOffs []oneOff
+	for _, s := range saved {
+		if s.App != app || s.Container != container {
+			oneOffs = append(oneOffs, s)
+		}
+	}
+	err = writeOneOffs(oneOffs)
+	if err != nil {
+		debug.Println("fail to write one-offs file:", err)
+	}
+}
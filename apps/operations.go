@@ -59,8 +59,8 @@ func handleOperation(app string, res *http.Response) error {
 				fmt.Printf("\bDone in %.3f seconds\n", op.ElapsedDuration())
 				return nil
 			} else if op.Status == "error" {
-				fmt.Printf("\bOperation '%s' failed, an error occurred: %v\n", op.Type, op.Error)
-				return nil
+				fmt.Println("\bFailed")
+				return errgo.Newf("operation '%s' failed, an error occurred: %v", op.Type, op.Error)
 			}
 		}
 	}
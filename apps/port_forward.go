@@ -0,0 +1,441 @@
+package apps
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	stdio "io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/debug"
+	"github.com/Scalingo/cli/net/tcp"
+	"gopkg.in/errgo.v1"
+)
+
+// The connections are multiplexed over the standard input and output of the
+// one-off container. A small agent is uploaded in the container, it connects
+// to the remote port and exchanges frames with the CLI:
+//
+//	magic (4 bytes) | connection ID (uint32) | type (uint8) | length (uint16) | payload
+//
+// The magic prefix lets both ends skip the bytes which are not part of a
+// frame, like the control characters sent by the CLI when a signal is caught.
+const (
+	frameOpen byte = iota + 1
+	frameData
+	frameClose
+	frameLog
+	frameReady
+	frameExit
+	framePing
+)
+
+const (
+	frameHeaderSize     = 11
+	portForwardAgent    = "scalingo-port-forward.pl"
+	portForwardAgentDir = "/tmp/uploads"
+)
+
+var frameMagic = []byte{0xfa, 0xce, 0xb0, 0x0c}
+
+type PortForwardOpts struct {
+	App        string
+	LocalPort  int
+	RemotePort int
+	Cmd        []string
+	Size       string
+}
+
+func PortForward(opts PortForwardOpts) error {
+	if len(opts.Cmd) == 0 {
+		cmd, err := webProcessCommand(opts.App)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		opts.Cmd = cmd
+	}
+
+	agentDir, err := ioutil.TempDir(os.TempDir(), "port-forward")
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	defer os.RemoveAll(agentDir)
+	agentPath := filepath.Join(agentDir, portForwardAgent)
+	err = ioutil.WriteFile(agentPath, []byte(portForwardAgentScript), 0644)
+	if err != nil {
+		return errgo.Notef(err, "fail to write port forwarding agent")
+	}
+
+	sock, err := tcp.Listen(opts.LocalPort)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer sock.Close()
+
+	forwarder := &portForwarder{
+		listener: sock,
+		conns:    map[uint32]net.Conn{},
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	fmt.Fprintf(os.Stderr, "Forwarding %v to port %d of the one-off container\n", sock.Addr(), opts.RemotePort)
+
+	// The terminal of the container is switched to raw mode, so that the
+	// frames are not altered by the line discipline.
+	cmd := []string{
+		"stty", "raw", "-echo", "&&",
+		"perl", portForwardAgentDir + "/" + portForwardAgent, strconv.Itoa(opts.RemotePort),
+	}
+	cmd = append(cmd, opts.Cmd...)
+
+	return Run(RunOpts{
+		App:            opts.App,
+		DisplayCmd:     fmt.Sprintf("port-forward %d:%d %s", opts.LocalPort, opts.RemotePort, strings.Join(opts.Cmd, " ")),
+		Cmd:            cmd,
+		CmdEnv:         []string{fmt.Sprintf("PORT=%d", opts.RemotePort)},
+		Files:          []string{agentPath},
+		Size:           opts.Size,
+		StdinCopyFunc:  forwarder.writeFrames,
+		StdoutCopyFunc: forwarder.readFrames,
+	})
+}
+
+func webProcessCommand(app string) ([]string, error) {
+	c := config.ScalingoClient()
+	processes, err := c.AppsPs(app)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	for _, p := range processes {
+		if p.Name == "web" && p.Command != "" {
+			return strings.Split(p.Command, " "), nil
+		}
+	}
+	return nil, errgo.New("no command given and no 'web' process type defined")
+}
+
+type portForwarder struct {
+	listener *net.TCPListener
+	socket   stdio.Writer
+	writeM   sync.Mutex
+	conns    map[uint32]net.Conn
+	connsM   sync.Mutex
+	ready    chan struct{}
+	done     chan struct{}
+}
+
+// writeFrames is used as the stdin copy function of the one-off: the local
+// connections are accepted once the agent is ready and their data are sent
+// to the container, the standard input of the CLI is ignored.
+func (pf *portForwarder) writeFrames(socket stdio.Writer, _ stdio.Reader) (int64, error) {
+	pf.socket = socket
+	select {
+	case <-pf.ready:
+	case <-pf.done:
+		return 0, nil
+	}
+
+	go func() {
+		err := tcp.Serve(pf.listener, pf.handleConn)
+		debug.Println("port forwarding listener closed:", err)
+	}()
+
+	<-pf.done
+	return 0, nil
+}
+
+func (pf *portForwarder) handleConn(id int, conn *net.TCPConn) {
+	connID := uint32(id)
+	fmt.Fprintf(os.Stderr, "New connection [%d]\n", connID)
+
+	pf.connsM.Lock()
+	pf.conns[connID] = conn
+	pf.connsM.Unlock()
+
+	err := pf.writeFrame(connID, frameOpen, nil)
+	if err != nil {
+		debug.Println("fail to open connection", connID, err)
+		pf.closeConn(connID)
+		return
+	}
+
+	buffer := make([]byte, 16*1024)
+	for {
+		n, err := conn.Read(buffer)
+		if n > 0 {
+			if werr := pf.writeFrame(connID, frameData, buffer[:n]); werr != nil {
+				debug.Println("fail to forward data of connection", connID, werr)
+				break
+			}
+		}
+		if err != nil {
+			if err != stdio.EOF {
+				debug.Println("fail to read connection", connID, err)
+			}
+			break
+		}
+	}
+
+	if pf.closeConn(connID) {
+		pf.writeFrame(connID, frameClose, nil)
+	}
+}
+
+// closeConn closes the local connection, it returns false if the connection
+// had already been closed.
+func (pf *portForwarder) closeConn(connID uint32) bool {
+	pf.connsM.Lock()
+	conn, ok := pf.conns[connID]
+	delete(pf.conns, connID)
+	pf.connsM.Unlock()
+	if !ok {
+		return false
+	}
+	conn.Close()
+	fmt.Fprintf(os.Stderr, "End of connection [%d]\n", connID)
+	return true
+}
+
+func (pf *portForwarder) writeFrame(connID uint32, frameType byte, payload []byte) error {
+	for len(payload) > 0xffff {
+		err := pf.writeFrame(connID, frameType, payload[:0xffff])
+		if err != nil {
+			return err
+		}
+		payload = payload[0xffff:]
+	}
+
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	copy(frame, frameMagic)
+	binary.BigEndian.PutUint32(frame[4:], connID)
+	frame[8] = frameType
+	binary.BigEndian.PutUint16(frame[9:], uint16(len(payload)))
+	frame = append(frame, payload...)
+
+	pf.writeM.Lock()
+	defer pf.writeM.Unlock()
+	_, err := pf.socket.Write(frame)
+	return err
+}
+
+// readFrames is used as the stdout copy function of the one-off, it
+// dispatches the frames sent by the agent until the container stops.
+func (pf *portForwarder) readFrames(_ stdio.Writer, socket stdio.Reader) (int64, error) {
+	defer pf.stop()
+
+	var (
+		read   int64
+		buffer []byte
+		chunk  = make([]byte, 32*1024)
+	)
+	for {
+		n, err := socket.Read(chunk)
+		read += int64(n)
+		buffer = append(buffer, chunk[:n]...)
+		buffer = pf.dispatchFrames(buffer)
+		if err != nil {
+			if err == stdio.EOF {
+				return read, nil
+			}
+			return read, err
+		}
+	}
+}
+
+// dispatchFrames handles the complete frames of the buffer and returns the
+// remaining bytes.
+func (pf *portForwarder) dispatchFrames(buffer []byte) []byte {
+	for {
+		magicIndex := bytes.Index(buffer, frameMagic)
+		if magicIndex == -1 {
+			// Keep the end of the buffer, it may be the beginning of a magic prefix
+			if len(buffer) >= len(frameMagic) {
+				debug.Printf("skipping %q\n", buffer[:len(buffer)-len(frameMagic)+1])
+				buffer = buffer[len(buffer)-len(frameMagic)+1:]
+			}
+			return buffer
+		}
+		if magicIndex > 0 {
+			debug.Printf("skipping %q\n", buffer[:magicIndex])
+			buffer = buffer[magicIndex:]
+		}
+		if len(buffer) < frameHeaderSize {
+			return buffer
+		}
+
+		connID := binary.BigEndian.Uint32(buffer[4:])
+		frameType := buffer[8]
+		length := int(binary.BigEndian.Uint16(buffer[9:]))
+		if len(buffer) < frameHeaderSize+length {
+			return buffer
+		}
+		payload := buffer[frameHeaderSize : frameHeaderSize+length]
+		pf.handleFrame(connID, frameType, payload)
+		buffer = buffer[frameHeaderSize+length:]
+	}
+}
+
+func (pf *portForwarder) handleFrame(connID uint32, frameType byte, payload []byte) {
+	switch frameType {
+	case frameReady:
+		fmt.Fprintf(os.Stderr, "Ready, you can connect to %v\n", pf.listener.Addr())
+		close(pf.ready)
+	case frameData:
+		pf.connsM.Lock()
+		conn, ok := pf.conns[connID]
+		pf.connsM.Unlock()
+		if !ok {
+			return
+		}
+		_, err := conn.Write(payload)
+		if err != nil {
+			debug.Println("fail to write to connection", connID, err)
+			if pf.closeConn(connID) {
+				pf.writeFrame(connID, frameClose, nil)
+			}
+		}
+	case frameClose:
+		if len(payload) > 0 {
+			fmt.Fprintf(os.Stderr, "Connection [%d] refused: %s\n", connID, payload)
+		}
+		pf.closeConn(connID)
+	case frameLog:
+		os.Stderr.Write(payload)
+	case frameExit:
+		fmt.Fprintf(os.Stderr, "The command has exited with status %s\n", payload)
+	case framePing:
+	default:
+		debug.Println("unknown frame type", frameType)
+	}
+}
+
+func (pf *portForwarder) stop() {
+	close(pf.done)
+	pf.listener.Close()
+	pf.connsM.Lock()
+	defer pf.connsM.Unlock()
+	for id, conn := range pf.conns {
+		conn.Close()
+		delete(pf.conns, id)
+	}
+}
+
+// portForwardAgentScript only relies on the core modules of Perl which is
+// available in the base image of the containers.
+const portForwardAgentScript = `use strict;
+use warnings;
+use IO::Select;
+use IO::Socket::INET;
+
+my $MAGIC = "\xfa\xce\xb0\x0c";
+my ($OPEN, $DATA, $CLOSE, $LOG, $READY, $EXIT, $PING) = (1 .. 7);
+
+my ($port, @cmd) = @ARGV;
+binmode(STDIN);
+binmode(STDOUT);
+
+my $sel = IO::Select->new(\*STDIN);
+my (%socks, %ids, $cmd_fh);
+
+sub write_all {
+  my ($fh, $buf) = @_;
+  while (length $buf) {
+    my $n = syswrite($fh, $buf);
+    return 0 unless defined $n;
+    substr($buf, 0, $n) = '';
+  }
+  return 1;
+}
+
+sub send_frame {
+  my ($id, $type, $data) = @_;
+  $data = '' unless defined $data;
+  write_all(\*STDOUT, $MAGIC . pack('NCn', $id, $type, length $data) . $data) or exit 1;
+}
+
+sub close_conn {
+  my ($id) = @_;
+  my $s = delete $socks{$id} or return;
+  delete $ids{fileno $s};
+  $sel->remove($s);
+  close($s);
+}
+
+if (@cmd) {
+  open($cmd_fh, '-|', join(' ', @cmd) . ' 2>&1') or die "fail to run command: $!";
+  $sel->add($cmd_fh);
+}
+
+send_frame(0, $READY);
+
+my $in = '';
+while (1) {
+  my @ready = $sel->can_read(30);
+  send_frame(0, $PING) unless @ready;
+  for my $fh (@ready) {
+    my $buf;
+    my $n = sysread($fh, $buf, 16384);
+    if (fileno($fh) == fileno(STDIN)) {
+      exit 0 unless $n;
+      $in .= $buf;
+      while (length $in) {
+        my $start = index($in, $MAGIC);
+        if ($start != 0) {
+          # A control character sent by the CLI outside of a frame: Ctrl-C or Ctrl-\
+          exit 130 if $in =~ /^[^\xfa]*[\x03\x1c]/;
+          if ($start == -1) {
+            $in = substr($in, -3);
+            last;
+          }
+          substr($in, 0, $start) = '';
+        }
+        last if length($in) < 11;
+        my ($id, $type, $len) = unpack('NCn', substr($in, 4, 7));
+        last if length($in) < 11 + $len;
+        my $data = substr($in, 11, $len);
+        substr($in, 0, 11 + $len) = '';
+        if ($type == $OPEN) {
+          my $s = IO::Socket::INET->new(PeerAddr => '127.0.0.1', PeerPort => $port, Proto => 'tcp');
+          if (!$s) {
+            send_frame($id, $CLOSE, "$!");
+            next;
+          }
+          binmode($s);
+          $socks{$id} = $s;
+          $ids{fileno $s} = $id;
+          $sel->add($s);
+        } elsif ($type == $DATA) {
+          my $s = $socks{$id} or next;
+          write_all($s, $data) or close_conn($id);
+        } elsif ($type == $CLOSE) {
+          close_conn($id);
+        }
+      }
+    } elsif ($cmd_fh && fileno($fh) == fileno($cmd_fh)) {
+      if (!$n) {
+        $sel->remove($cmd_fh);
+        close($cmd_fh);
+        send_frame(0, $EXIT, $? >> 8);
+        exit 0;
+      }
+      send_frame(0, $LOG, $buf);
+    } else {
+      my $id = $ids{fileno $fh};
+      if (!$n) {
+        close_conn($id);
+        send_frame($id, $CLOSE);
+        next;
+      }
+      send_frame($id, $DATA, $buf);
+    }
+  }
+}
+`
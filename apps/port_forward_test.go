@@ -0,0 +1,47 @@
+package apps
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestPortForwarderDispatchFrames(t *testing.T) {
+	socket := new(bytes.Buffer)
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	pf := &portForwarder{
+		socket: socket,
+		conns:  map[uint32]net.Conn{42: local},
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	err := pf.writeFrame(42, frameData, []byte("hello"))
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	frame := socket.Bytes()
+
+	// Noise before the frame, and a frame split in two reads
+	buffer := pf.dispatchFrames(append([]byte("\r\n\x03"), frame[:7]...))
+	if !bytes.Equal(buffer, frame[:7]) {
+		t.Fatalf("expected the noise to be skipped, got %q", buffer)
+	}
+
+	received := make(chan []byte)
+	go func() {
+		b := make([]byte, 5)
+		n, _ := remote.Read(b)
+		received <- b[:n]
+	}()
+
+	buffer = pf.dispatchFrames(append(buffer, frame[7:]...))
+	if len(buffer) != 0 {
+		t.Fatalf("expected the frame to be consumed, got %q", buffer)
+	}
+	if data := <-received; string(data) != "hello" {
+		t.Fatalf("expected 'hello' to be forwarded, got %q", data)
+	}
+}
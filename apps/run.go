@@ -18,11 +18,15 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/Scalingo/cli/apps/run"
 	"github.com/Scalingo/cli/config"
 	"github.com/Scalingo/cli/debug"
+	"github.com/Scalingo/cli/env/dotenv"
+	"github.com/Scalingo/cli/env/mask"
 	"github.com/Scalingo/cli/httpclient"
 	"github.com/Scalingo/cli/io"
 	"github.com/Scalingo/cli/signals"
@@ -40,6 +44,9 @@ type RunOpts struct {
 	Type           string
 	Cmd            []string
 	CmdEnv         []string
+	EnvFiles       []string
+	UnsetEnv       []string
+	PrintEnv       bool
 	Files          []string
 	StdinCopyFunc  func(stdio.Writer, stdio.Reader) (int64, error)
 	StdoutCopyFunc func(stdio.Writer, stdio.Reader) (int64, error)
@@ -51,18 +58,31 @@ type runContext struct {
 	waitingTextOutputWriter stdio.Writer
 	stdinCopyFunc           func(stdio.Writer, stdio.Reader) (int64, error)
 	stdoutCopyFunc          func(stdio.Writer, stdio.Reader) (int64, error)
+	// stdoutCopyFailure is set when the error of a custom stdout copy function
+	// has to make the run fail
+	stdoutCopyFailure bool
+	firstReadDone     chan struct{}
+	// startSpinnerDone is closed once the spinner waiting for the first read
+	// has displayed its last message
+	startSpinnerDone chan struct{}
 }
 
-func Run(opts RunOpts) error {
-	c := config.ScalingoClient()
-
+func newRunContext(app string) *runContext {
 	firstReadDone := make(chan struct{})
-	ctx := &runContext{
-		app: opts.App,
+	return &runContext{
+		app:                     app,
 		waitingTextOutputWriter: os.Stderr,
 		stdinCopyFunc:           stdio.Copy,
 		stdoutCopyFunc:          io.CopyWithFirstReadChan(firstReadDone),
+		firstReadDone:           firstReadDone,
+		startSpinnerDone:        make(chan struct{}),
 	}
+}
+
+func Run(opts RunOpts) error {
+	c := config.ScalingoClient()
+
+	ctx := newRunContext(opts.App)
 	if opts.Type != "" {
 		processes, err := c.AppsPs(opts.App)
 		if err != nil {
@@ -95,14 +115,41 @@ func Run(opts RunOpts) error {
 		ctx.stdinCopyFunc = opts.StdinCopyFunc
 	}
 	if opts.StdoutCopyFunc != nil {
-		ctx.stdoutCopyFunc = opts.StdoutCopyFunc
+		stdoutCopyFunc := opts.StdoutCopyFunc
+		ctx.stdoutCopyFunc = func(dst stdio.Writer, src stdio.Reader) (int64, error) {
+			return stdoutCopyFunc(dst, io.ReaderWithFirstReadChan(src, ctx.firstReadDone, ctx.startSpinnerDone))
+		}
+		ctx.stdoutCopyFailure = true
 	}
 
-	env, err := ctx.buildEnv(opts.CmdEnv)
+	env, err := ctx.buildEnv(opts.EnvFiles, opts.CmdEnv)
 	if err != nil {
 		return errgo.Mask(err, errgo.Any)
 	}
 
+	for _, name := range opts.UnsetEnv {
+		if !dotenv.ValidName(name) {
+			return errgo.Newf("'%s' is not a valid environment variable name", name)
+		}
+	}
+
+	if opts.PrintEnv {
+		return ctx.printEnv(env, opts.UnsetEnv)
+	}
+
+	if opts.DisplayCmd == "" {
+		opts.DisplayCmd = strings.Join(opts.Cmd, " ")
+	}
+	if len(opts.UnsetEnv) > 0 {
+		// The variables of the application are injected by the platform, they
+		// are removed by env(1) when it starts the command.
+		unsetCmd := []string{"env"}
+		for _, name := range opts.UnsetEnv {
+			unsetCmd = append(unsetCmd, "-u", name)
+		}
+		opts.Cmd = append(unsetCmd, opts.Cmd...)
+	}
+
 	err = ctx.validateFiles(opts.Files)
 	if err != nil {
 		return errgo.Mask(err, errgo.Any)
@@ -121,10 +168,21 @@ func Run(opts RunOpts) error {
 	debug.Printf("%+v\n", runRes)
 
 	if opts.Detached {
+		err := saveOneOff(oneOff{
+			App:       opts.App,
+			Container: runRes.Container.FullType(),
+			Command:   opts.DisplayCmd,
+			AttachURL: runRes.AttachURL,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			debug.Println("fail to save one-off attach URL:", err)
+		}
 		fmt.Printf(
 			"Starting one-off '%s' for app '%v'.\nRun `scalingo -a %v logs -F %v` to get the output\n",
-			io.Bold(strings.Join(opts.Cmd, " ")), io.Bold(opts.App), opts.App, runRes.Container.FullType(),
+			io.Bold(opts.DisplayCmd), io.Bold(opts.App), opts.App, runRes.Container.FullType(),
 		)
+		fmt.Printf("Run `scalingo -a %v run-attach %v` to attach to it\n", opts.App, runRes.Container.FullType())
 		return nil
 	}
 
@@ -146,13 +204,7 @@ func Run(opts RunOpts) error {
 
 	attachSpinner := io.NewSpinner(ctx.waitingTextOutputWriter)
 	attachSpinner.PostHook = func() {
-		var displayCmd string
-		if opts.DisplayCmd != "" {
-			displayCmd = opts.DisplayCmd
-		} else {
-			displayCmd = strings.Join(opts.Cmd, " ")
-		}
-		fmt.Fprintf(ctx.waitingTextOutputWriter, "\n-----> Process '%v' is starting...  ", displayCmd)
+		fmt.Fprintf(ctx.waitingTextOutputWriter, "\n-----> Process '%v' is starting...  ", opts.DisplayCmd)
 	}
 	go attachSpinner.Start()
 
@@ -164,9 +216,21 @@ func Run(opts RunOpts) error {
 		return errgo.Newf("Fail to attach: %s", res.Status)
 	}
 
+	exitCode, err := ctx.attach(socket, attachSpinner)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	os.Exit(exitCode)
+	return nil
+}
+
+// attach plugs the standard input and output to the socket connected to the
+// run server until the process ends, its exit code is then returned.
+func (ctx *runContext) attach(socket net.Conn, attachSpinner *io.Spinner) (int, error) {
 	if term.IsATTY(os.Stdin) {
 		if err := term.MakeRaw(os.Stdin); err != nil {
-			return errgo.Mask(err, errgo.Any)
+			return -1, errgo.Mask(err, errgo.Any)
 		}
 	}
 
@@ -191,7 +255,8 @@ func Run(opts RunOpts) error {
 	}()
 
 	attachSpinner.Stop()
-	startSpinner := io.NewSpinnerWithStopChan(ctx.waitingTextOutputWriter, firstReadDone)
+	startSpinner := io.NewSpinnerWithStopChan(ctx.waitingTextOutputWriter, ctx.firstReadDone)
+	startSpinner.Done = ctx.startSpinnerDone
 	// This method will be executed after first read
 	startSpinner.PostHook = func() {
 		go run.NotifyTermSizeUpdate(signals)
@@ -210,31 +275,40 @@ func Run(opts RunOpts) error {
 		}
 	}()
 
-	_, err = ctx.stdoutCopyFunc(os.Stdout, socket)
+	_, copyErr := ctx.stdoutCopyFunc(os.Stdout, socket)
 
 	stopSignalsMonitoring <- true
 
 	if term.IsATTY(os.Stdin) {
 		if err := term.Restore(os.Stdin); err != nil {
-			return errgo.Mask(err, errgo.Any)
+			return -1, errgo.Mask(err, errgo.Any)
 		}
 	}
 
-	exitCode, err := ctx.exitCode()
-	if err != nil {
-		return errgo.Mask(err, errgo.Any)
+	if copyErr != nil && ctx.stdoutCopyFailure {
+		return -1, errgo.Mask(copyErr, errgo.Any)
 	}
 
-	os.Exit(exitCode)
-	return nil
+	return ctx.exitCode()
 }
 
-func (ctx *runContext) buildEnv(cmdEnv []string) (map[string]string, error) {
+func (ctx *runContext) buildEnv(envFiles []string, cmdEnv []string) (map[string]string, error) {
 	env := map[string]string{
 		"TERM":      os.Getenv("TERM"),
 		"CLIENT_OS": runtime.GOOS,
 	}
 
+	// Variables from the files are overriden by the ones given with '--env'
+	for _, envFile := range envFiles {
+		vars, err := dotenv.ParseFile(envFile)
+		if err != nil {
+			return nil, errgo.Mask(err, errgo.Any)
+		}
+		for _, v := range vars {
+			env[v.Name] = v.Value
+		}
+	}
+
 	for _, cmdVar := range cmdEnv {
 		v := strings.Split(cmdVar, "=")
 		if len(v) != 2 || len(v[0]) == 0 || len(v[1]) == 0 {
@@ -245,6 +319,38 @@ func (ctx *runContext) buildEnv(cmdEnv []string) (map[string]string, error) {
 	return env, nil
 }
 
+// printEnv displays the environment the one-off container would receive,
+// secret values are masked.
+func (ctx *runContext) printEnv(cmdEnv map[string]string, unsetEnv []string) error {
+	c := config.ScalingoClient()
+	vars, err := c.VariablesListWithoutAlias(ctx.app)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	env := map[string]string{}
+	for _, v := range vars {
+		env[v.Name] = v.Value
+	}
+	for name, value := range cmdEnv {
+		env[name] = value
+	}
+	for _, name := range unsetEnv {
+		delete(env, name)
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("%s=%s\n", name, mask.Variable(mask.Patterns(config.C.ScalingoSecretPatterns), name, env[name]))
+	}
+	return nil
+}
+
 func (ctx *runContext) exitCode() (int, error) {
 	if ctx.attachURL == "" {
 		return -1, errgo.New("No attach URL to connect to")
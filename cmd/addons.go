@@ -36,6 +36,46 @@ var (
 			autocomplete.CmdFlagsAutoComplete(c, "addons")
 		},
 	}
+	AddonsInfoCommand = cli.Command{
+		Name:     "addons-info",
+		Category: "Addons",
+		Usage:    "Display the details of an addon",
+		Flags: []cli.Flag{appFlag, cli.BoolFlag{
+			Name:  "token",
+			Usage: "Only print a short-lived token to access the database API of the addon",
+		}},
+		Description: ` Display the provider, the plan, the status, the environment variables and the
+ latest backup of an addon:
+    $ scalingo -a myapp addons-info <addon-id>
+
+ With --token, a short-lived token is generated for the scripts calling the
+ database API directly:
+    $ curl -H "Authorization: Bearer $(scalingo -a myapp addons-info --token <addon-id>)" ...
+
+		# See also 'addons' and 'backups'
+`,
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 1 {
+				cli.ShowCommandHelp(c, "addons-info")
+				return
+			}
+
+			var err error
+			if c.Bool("token") {
+				err = addons.Token(currentApp, c.Args()[0])
+			} else {
+				err = addons.Info(currentApp, c.Args()[0])
+			}
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "addons-info")
+		},
+	}
 	AddonsAddCommand = cli.Command{
 		Name:     "addons-add",
 		Category: "Addons",
@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/Scalingo/cli/appdetect"
+	"github.com/Scalingo/cli/cmd/autocomplete"
 	"github.com/Scalingo/cli/db"
+	"github.com/Scalingo/cli/utils"
 	"github.com/urfave/cli"
 )
 
@@ -43,24 +46,58 @@ var (
 		}, cli.BoolFlag{
 			Name:  "silent, s",
 			Usage: "Do not show progress bar and loading messages",
+		}, cli.BoolFlag{
+			Name:  "latest",
+			Usage: "Download the most recent successful backup",
+		}, cli.StringFlag{
+			Name:  "before",
+			Usage: "Download the most recent successful backup created before this date (YYYY-MM-DD, 'YYYY-MM-DD HH:MM' or RFC3339)",
+		}, cli.StringFlag{
+			Name:  "checksum",
+			Usage: "Expected checksum of the archive (sha256:<hex>, sha1:<hex> or md5:<hex>)",
 		}},
 		Description: `  Download a specific backup:
 		$ scalingo -a myapp --addon addon_uuid backup-download --backup my_backup
 
+  Download the most recent backup, or the most recent one before a date:
+		$ scalingo -a myapp --addon addon_uuid backup-download --latest
+		$ scalingo -a myapp --addon addon_uuid backup-download --before 2018-03-01
+
+  The archive is downloaded to a '.part' file until it is complete and its size has been
+  checked. If the download is interrupted, it is resumed automatically, or when the command
+  is run again with the same output. The checksum of the archive can also be verified:
+		$ scalingo -a myapp --addon addon_uuid backup-download --backup my_backup --checksum sha256:2c26b46b...
+
 		# See also 'backups' and 'addons'`,
 		Before: AuthenticateHook,
 		Action: func(c *cli.Context) {
 			currentApp := appdetect.CurrentApp(c)
 			addon := addonName(c)
 			backup := c.String("backup")
+			if backup == "" && (c.Bool("latest") || c.String("before") != "") {
+				var before time.Time
+				if c.String("before") != "" {
+					var err error
+					before, err = utils.ParseDate(c.String("before"))
+					if err != nil {
+						errorQuit(err)
+					}
+				}
+				latest, err := db.LatestBackup(currentApp, addon, before)
+				if err != nil {
+					errorQuit(err)
+				}
+				backup = latest.ID
+			}
 			if backup == "" {
-				fmt.Println("Please specify a backup using the --backup flag")
+				fmt.Println("Please specify a backup using the --backup, --latest or --before flags")
 				return
 			}
 
 			opts := db.DownloadBackupOpts{
-				Output: c.String("output"),
-				Silent: c.Bool("silent"),
+				Output:   c.String("output"),
+				Silent:   c.Bool("silent"),
+				Checksum: c.String("checksum"),
 			}
 
 			err := db.DownloadBackup(currentApp, addon, backup, opts)
@@ -69,4 +106,112 @@ var (
 			}
 		},
 	}
+
+	BackupRestoreLocalCommand = cli.Command{
+		Name:     "backups-restore-local",
+		Category: "Addons",
+		Usage:    "Restore a backup into a local database",
+		Flags: []cli.Flag{appFlag, addonFlag, cli.StringFlag{
+			Name:  "target, t",
+			Usage: "URL of the local database to restore the backup into",
+		}, cli.StringFlag{
+			Name:  "config, c",
+			Usage: "JSON file declaring the anonymisation hooks (default: " + db.DefaultRestoreConfigFile + " if present)",
+		}},
+		Description: `  Download a backup and restore it into a local database with the local restore tool
+  matching the format of the dump (pg_restore, psql, mysql or mongorestore):
+		$ scalingo -a myapp --addon addon_uuid backups-restore-local --target postgres://localhost/dev my_backup
+
+  Redis backups are RDB files, they are written at the given path to be loaded by
+  the local Redis server when it starts:
+		$ scalingo -a myapp --addon addon_uuid backups-restore-local --target /var/lib/redis/dump.rdb my_backup
+
+  Columns can be anonymised once a SQL backup is restored, with a configuration file:
+		{
+		  "anonymize": [
+		    {"table": "users", "column": "email", "value": "'user' || id || '@example.com'"},
+		    {"table": "users", "column": "phone"}
+		  ],
+		  "after_restore": ["DELETE FROM sessions"]
+		}
+  The value is a SQL expression, the column is set to NULL if it is empty.
+
+		# See also 'backups' and 'backup-download'`,
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			addon := addonName(c)
+			if len(c.Args()) != 1 || c.String("target") == "" {
+				cli.ShowCommandHelp(c, "backups-restore-local")
+				return
+			}
+
+			opts := db.RestoreLocalOpts{
+				Target: c.String("target"),
+				Config: c.String("config"),
+			}
+
+			err := db.RestoreBackupLocally(currentApp, addon, c.Args()[0], opts)
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "backups-restore-local")
+		},
+	}
+
+	BackupSyncCommand = cli.Command{
+		Name:     "backups-sync",
+		Category: "Addons",
+		Usage:    "Mirror the backups of an addon in a local directory",
+		Flags: []cli.Flag{appFlag, addonFlag, cli.StringFlag{
+			Name:  "dir, d",
+			Usage: "Directory where the backups are mirrored",
+		}, cli.IntFlag{
+			Name:  "keep, k",
+			Usage: "Number of backups to keep locally, the older ones are removed (0 keeps all of them)",
+		}, cli.BoolFlag{
+			Name:  "all-apps",
+			Usage: "Mirror the backups of all the databases of all your applications",
+		}},
+		Description: `  Download the successful backups of an addon which are not already in the directory,
+  and remove the local copies beyond the retention:
+		$ scalingo -a myapp --addon addon_uuid backups-sync --dir /srv/backups --keep 30
+
+  Mirror the backups of all the databases of all your applications, in a
+  <dir>/<app>/<addon_id> directory per addon:
+		$ scalingo backups-sync --all-apps --dir /srv/backups --keep 30
+
+  A manifest.json file listing the mirrored backups with their SHA256 checksum is written
+  in each directory. A lock file prevents two syncs from running at the same time, and the
+  command exits with a non-zero status if any backup fails to download, it is safe to run
+  from cron.
+
+		# See also 'backups' and 'backup-download'`,
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			if c.String("dir") == "" || len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "backups-sync")
+				return
+			}
+			opts := db.BackupSyncOpts{
+				Dir:  c.String("dir"),
+				Keep: c.Int("keep"),
+			}
+
+			var err error
+			if c.Bool("all-apps") {
+				err = db.SyncAllBackups(opts)
+			} else {
+				err = db.SyncBackups(appdetect.CurrentApp(c), addonName(c), opts)
+			}
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "backups-sync")
+		},
+	}
 )
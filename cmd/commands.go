@@ -16,6 +16,9 @@ var (
 		LogsCommand,
 		LogsArchivesCommand,
 		RunCommand,
+		OneOffsCommand,
+		RunAttachCommand,
+		PortForwardCommand,
 
 		// Apps Process Actions
 		psCommand,
@@ -34,14 +37,30 @@ var (
 
 		// Environment
 		envCommand,
+		envGetCommand,
 		envSetCommand,
 		envUnsetCommand,
+		envExportCommand,
+		envImportCommand,
+		envEditCommand,
+		envDiffCommand,
+		envCopyCommand,
+		envHistoryCommand,
+
+		// Secrets
+		secretsKeygenCommand,
+		secretsEncryptCommand,
+		secretsDecryptCommand,
+		secretsEditCommand,
+		secretsPushCommand,
 
 		// Domains
 		DomainsListCommand,
 		DomainsAddCommand,
 		DomainsRemoveCommand,
 		DomainsSSLCommand,
+		DomainsSSLInspectCommand,
+		DomainsExpiringCommand,
 
 		// Deployments
 		DeploymentsListCommand,
@@ -59,6 +78,7 @@ var (
 		AddonProvidersListCommand,
 		AddonProvidersPlansCommand,
 		AddonsListCommand,
+		AddonsInfoCommand,
 		AddonsAddCommand,
 		AddonsRemoveCommand,
 		AddonsUpgradeCommand,
@@ -80,10 +100,15 @@ var (
 		MySQLConsoleCommand,
 		PgSQLConsoleCommand,
 		InfluxDBConsoleCommand,
+		ElasticsearchConsoleCommand,
+		DbDumpCommand,
+		DbRestoreCommand,
 
 		// Backups
 		BackupListCommand,
 		BackupDownloadCommand,
+		BackupRestoreLocalCommand,
+		BackupSyncCommand,
 
 		// TODO: Alerts
 		alertsListCommand,
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"github.com/Scalingo/cli/appdetect"
+	"github.com/Scalingo/cli/cmd/autocomplete"
+	"github.com/Scalingo/cli/db"
+	"github.com/urfave/cli"
+)
+
+var (
+	DbDumpCommand = cli.Command{
+		Name:     "db-dump",
+		Category: "Databases",
+		Usage:    "Dump a database addon into a local file",
+		Flags: []cli.Flag{appFlag, addonFlag, envVarFlag,
+			cli.StringFlag{Name: "output, o", Usage: "Output file (default <app>-<database>-<date>.<ext>.gz)"},
+			cli.StringFlag{Name: "size, s", Value: "", Usage: "Size of the container"},
+		},
+		Description: ` Dump a PostgreSQL, MySQL, MongoDB or Redis addon into a local file.
+
+   The native dump tool (pg_dump, mysqldump, mongodump or redis-cli) is run in
+   a one-off container and the dump is streamed, compressed, to your computer.
+   The file is kept compressed if its name ends with '.gz'.
+
+   Examples
+    scalingo --app myapp db-dump --addon ad-0123 --output dump.sql.gz
+    scalingo --app myapp db-dump --env-var SCALINGO_MYSQL_URL --output dump.sql
+
+   Without --addon or --env-var, the addon given in the SCALINGO_ADDON
+   environment variable is used and displayed.
+
+   PostgreSQL and MySQL dumps are SQL scripts, MongoDB dumps are archives
+   (mongodump --archive) and Redis dumps are RESTORE commands in the Redis
+   protocol, which can be sent with 'redis-cli --pipe'.
+
+    # See also 'db-restore' and 'backups'
+`,
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "db-dump")
+				return
+			}
+			opts := db.DumpOpts{
+				App: currentApp,
+				Addon: db.AddonSelector{
+					AddonID: optionalAddonName(c),
+					EnvVar:  c.String("env-var"),
+				},
+				Output: c.String("output"),
+				Size:   c.String("size"),
+			}
+			err := db.Dump(opts)
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "db-dump")
+		},
+	}
+
+	DbRestoreCommand = cli.Command{
+		Name:     "db-restore",
+		Category: "Databases",
+		Usage:    "Restore a local dump into a database addon",
+		Flags: []cli.Flag{appFlag, addonFlag, envVarFlag,
+			cli.StringFlag{Name: "size, s", Value: "", Usage: "Size of the container"},
+		},
+		Description: ` Restore a local dump into a PostgreSQL, MySQL, MongoDB or Redis addon.
+
+   The dump is streamed, compressed, to a one-off container running the native
+   restore tool (psql, mysql, mongorestore or redis-cli --pipe). The current
+   data of the database are overwritten, the name of the application has to be
+   typed to confirm the operation.
+
+   Examples
+    scalingo --app myapp db-restore --addon ad-0123 dump.sql.gz
+    scalingo --app myapp db-restore --env-var SCALINGO_MONGO_URL dump.archive
+
+   Without --addon or --env-var, the addon given in the SCALINGO_ADDON
+   environment variable is used and displayed before the confirmation.
+
+   PostgreSQL and MySQL dumps are SQL scripts, MongoDB dumps are archives
+   (mongodump --archive). Redis dumps are the RESTORE commands written by
+   'db-dump', the keys of the dump replace the existing ones.
+
+    # See also 'db-dump'
+`,
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 1 {
+				cli.ShowCommandHelp(c, "db-restore")
+				return
+			}
+			opts := db.RestoreOpts{
+				App: currentApp,
+				Addon: db.AddonSelector{
+					AddonID: optionalAddonName(c),
+					EnvVar:  c.String("env-var"),
+				},
+				Input: c.Args()[0],
+				Size:  c.String("size"),
+			}
+			err := db.Restore(opts)
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "db-restore")
+		},
+	}
+)
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/Scalingo/cli/appdetect"
 	"github.com/Scalingo/cli/cmd/autocomplete"
 	"github.com/Scalingo/cli/domains"
+	"github.com/Scalingo/cli/utils"
 	"github.com/urfave/cli"
 )
 
@@ -124,6 +127,11 @@ var (
 
 		$ scalingo -a myapp domains-ssl example.com disable
 
+		The certificate file contains the certificate of the domain followed by the
+		intermediate certificates. It is checked before being sent: the key must
+		match, the chain must be complete and ordered, and the certificate must be
+		valid for the domain.
+
 		# See also commands 'domains' and 'domains-add'`,
 
 		Before: AuthenticateHook,
@@ -203,4 +211,74 @@ var (
 			autocomplete.CmdFlagsAutoComplete(c, "unset-canonical-domain")
 		},
 	}
+
+	DomainsSSLInspectCommand = cli.Command{
+		Name:     "domains-ssl-inspect",
+		Category: "Custom Domains",
+		Usage:    "Display the SSL certificate of a custom domain",
+		Flags:    []cli.Flag{appFlag},
+		Description: `Display the issuer, the names and the validity of the certificate installed
+for a custom domain:
+
+		$ scalingo -a myapp domains-ssl-inspect example.com
+
+		# See also commands 'domains-ssl' and 'domains'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 1 {
+				cli.ShowCommandHelp(c, "domains-ssl-inspect")
+				return
+			}
+			err := domains.InspectSSL(currentApp, c.Args()[0])
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "domains-ssl-inspect")
+			autocomplete.DomainsRemoveAutoComplete(c)
+		},
+	}
+
+	DomainsExpiringCommand = cli.Command{
+		Name:     "domains-expiring",
+		Category: "Custom Domains",
+		Usage:    "List the custom certificates of all your apps about to expire",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "within", Value: "30d", Usage: "Report the certificates expiring within this duration (30d, 12h)"},
+		},
+		Description: `List the custom domains of all your applications whose certificate expires
+soon, or has already expired:
+
+		$ scalingo domains-expiring --within 30d
+
+		The command exits with a non-zero status when a certificate is found, it can
+		be run as a periodic check.
+
+		# See also commands 'domains-ssl' and 'domains-ssl-inspect'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			if len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "domains-expiring")
+				return
+			}
+			within, err := utils.ParseDuration(c.String("within"))
+			if err != nil {
+				errorQuit(err)
+			}
+			found, err := domains.Expiring(within)
+			if err != nil {
+				errorQuit(err)
+			}
+			if found > 0 {
+				os.Exit(1)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "domains-expiring")
+		},
+	}
 )
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"github.com/Scalingo/cli/appdetect"
+	"github.com/Scalingo/cli/cmd/autocomplete"
+	"github.com/Scalingo/cli/db"
+	"github.com/urfave/cli"
+)
+
+var (
+	ElasticsearchConsoleCommand = cli.Command{
+		Name:     "elasticsearch-console",
+		Category: "Databases",
+		Usage:    "Run an interactive console with your Elasticsearch addon",
+		Flags:    []cli.Flag{appFlag, addonFlag, envVarFlag, identityFlag, knownHostsFlag, insecureHostKeyFlag},
+		Description: ` Run an interactive HTTP console with your Elasticsearch addon.
+
+   Examples
+    scalingo --app myapp elasticsearch-console
+
+   The requests are sent from your computer through an SSH-encrypted tunnel
+   (see 'db-tunnel'), closed when the console exits. They are written as
+   'METHOD /path [body]', the JSON body can span several lines:
+
+    elasticsearch> GET /_cat/indices?v
+    elasticsearch> POST /myindex/_search {"query": {"match_all": {}}}
+
+   The requests are kept in a history, listed with 'history' and run again
+   with '!!' or '!N'. Ctrl-C cancels the running request.
+
+   The SSH key and the host key of the SSH server are handled as for
+   'db-tunnel', the '--identity', '--known-hosts' and '--insecure-skip-host-key'
+   flags work the same way.
+
+   When the application has several addons of this kind, the one to use can be
+   chosen with its ID (--addon) or with the name of the environment variable
+   containing its connection URL (--env-var). Otherwise you are asked to choose.
+
+    # See also 'redis-console' and 'db-tunnel'
+`,
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			opts := db.ConsoleOpts{
+				App: currentApp,
+				Addon: db.AddonSelector{
+					AddonID: optionalAddonName(c),
+					EnvVar:  c.String("env-var"),
+				},
+				Identity: sshIdentity(c),
+				HostKey:  hostKeyOpts(c),
+			}
+			if len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "elasticsearch-console")
+			} else if err := db.Console(db.ElasticsearchConsole, opts); err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "elasticsearch-console")
+		},
+	}
+)
@@ -1,30 +1,56 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/Scalingo/cli/appdetect"
 	"github.com/Scalingo/cli/cmd/autocomplete"
 	"github.com/Scalingo/cli/env"
+	"github.com/Scalingo/cli/utils"
 	"github.com/urfave/cli"
 )
 
 var (
+	envRestartFlag = cli.BoolFlag{
+		Name:  "restart",
+		Usage: "Restart the containers once the environment is modified",
+	}
+	envRestartScopeFlag = cli.StringFlag{
+		Name:  "restart-scope",
+		Usage: "Comma-separated list of container types or names to restart, implies --restart (default all)",
+	}
+	envRevertFlag = cli.BoolFlag{
+		Name:  "revert-on-failure",
+		Usage: "Restore the previous environment if the restart fails",
+	}
+
 	envCommand = cli.Command{
 		Name:     "env",
 		Category: "Environment",
-		Flags:    []cli.Flag{appFlag},
-		Usage:    "Display the environment of your apps",
+		Flags: []cli.Flag{appFlag,
+			cli.BoolFlag{Name: "reveal", Usage: "Display the values of the secrets"},
+		},
+		Usage: "Display the environment of your apps",
 		Description: `List all the environment variables:
 
     $ scalingo -a myapp env
 
-    # See also commands 'env-set' and 'env-unset'`,
+The values of the secrets are masked, unless --reveal is given. Variables whose name
+matches *_KEY, *_SECRET, *_TOKEN or *_PASSWORD, and URLs containing a password are
+considered as secrets. Additional patterns can be configured with the comma-separated
+SCALINGO_SECRET_PATTERNS environment variable:
+
+    $ export SCALINGO_SECRET_PATTERNS='*_DSN,LICENSE_*'
+    $ scalingo -a myapp env --reveal
+
+    # See also commands 'env-get', 'env-set' and 'env-unset'`,
 
 		Before: AuthenticateHook,
 		Action: func(c *cli.Context) {
 			currentApp := appdetect.CurrentApp(c)
 			var err error
 			if len(c.Args()) == 0 {
-				err = env.Display(currentApp)
+				err = env.Display(currentApp, env.DisplayOpts{Reveal: c.Bool("reveal")})
 			} else {
 				cli.ShowCommandHelp(c, "env")
 			}
@@ -38,15 +64,73 @@ var (
 		},
 	}
 
+	envGetCommand = cli.Command{
+		Name:     "env-get",
+		Category: "Environment",
+		Flags:    []cli.Flag{appFlag},
+		Usage:    "Display the raw value of an environment variable",
+		Description: `Display the value of a variable, without masking it:
+
+    $ scalingo -a myapp env-get DATABASE_URL
+    $ psql "$(scalingo -a myapp env-get DATABASE_URL)"
+
+    # See also commands 'env' and 'env-set'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 1 {
+				cli.ShowCommandHelp(c, "env-get")
+				return
+			}
+			err := env.Get(currentApp, c.Args()[0])
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "env-get")
+			autocomplete.EnvUnsetAutoComplete(c)
+		},
+	}
+
 	envSetCommand = cli.Command{
 		Name:     "env-set",
 		Category: "Environment",
-		Flags:    []cli.Flag{appFlag},
-		Usage:    "Set the environment variables of your apps",
+		Flags: []cli.Flag{appFlag,
+			cli.BoolFlag{Name: "allow-empty", Usage: "Accept variables with an empty value"},
+			envRestartFlag, envRestartScopeFlag, envRevertFlag,
+		},
+		Usage: "Set the environment variables of your apps",
 		Description: `Set variables:
 
     $ scalingo -a myapp env-set VAR1=VAL1 VAR2=VAL2
 
+A value starting with '@' is read from a file, '-' reads the standard input
+(the final new line is removed), which is handy for multi-line values:
+
+    $ scalingo -a myapp env-set TLS_KEY=@certs/server.key
+    $ cat credentials.json | scalingo -a myapp env-set GOOGLE_CREDENTIALS=-
+
+Start the value with '@@' to set a value starting with a literal '@':
+
+    $ scalingo -a myapp env-set TWITTER_HANDLE=@@scalingo
+
+Secrets can be generated, they are never displayed (quote them to prevent the
+shell from interpreting them):
+
+    $ scalingo -a myapp env-set 'SECRET_KEY_BASE=$(random:64)' 'INSTANCE_ID=$(uuid)'
+
+Empty values are refused unless --allow-empty is given.
+
+Restart the containers to apply the changes right away with --restart, all of
+them or a comma-separated list of container types or names given with
+--restart-scope. If the restart fails, the previous values are restored with
+--revert-on-failure:
+
+    $ scalingo -a myapp env-set --restart VAR1=VAL1
+    $ scalingo -a myapp env-set --restart-scope web,worker --revert-on-failure VAR1=VAL1
+
     # See also commands 'env' and 'env-unset'`,
 
 		Before: AuthenticateHook,
@@ -54,7 +138,10 @@ var (
 			currentApp := appdetect.CurrentApp(c)
 			var err error
 			if len(c.Args()) > 0 {
-				err = env.Add(currentApp, c.Args())
+				err = env.Add(currentApp, c.Args(), env.AddOpts{
+					RestartOpts: envRestartOpts(c),
+					AllowEmpty:  c.Bool("allow-empty"),
+				})
 			} else {
 				cli.ShowCommandHelp(c, "env-set")
 				return
@@ -71,11 +158,12 @@ var (
 	envUnsetCommand = cli.Command{
 		Name:     "env-unset",
 		Category: "Environment",
-		Flags:    []cli.Flag{appFlag},
+		Flags:    []cli.Flag{appFlag, envRestartFlag, envRestartScopeFlag, envRevertFlag},
 		Usage:    "Unset environment variables of your apps",
 		Description: `Unset variables:
 
     $ scalingo -a myapp env-unset VAR1 VAR2
+    $ scalingo -a myapp env-unset --restart VAR1
 
     # See also commands 'env' and 'env-set'`,
 
@@ -84,7 +172,7 @@ var (
 			currentApp := appdetect.CurrentApp(c)
 			var err error
 			if len(c.Args()) > 0 {
-				err = env.Delete(currentApp, c.Args())
+				err = env.Delete(currentApp, c.Args(), env.DeleteOpts{RestartOpts: envRestartOpts(c)})
 			} else {
 				cli.ShowCommandHelp(c, "env-unset")
 			}
@@ -97,4 +185,258 @@ var (
 			autocomplete.EnvUnsetAutoComplete(c)
 		},
 	}
+
+	envExportCommand = cli.Command{
+		Name:     "env-export",
+		Category: "Environment",
+		Flags: []cli.Flag{appFlag, cli.StringFlag{
+			Name:  "format, f",
+			Value: "dotenv",
+			Usage: "Output format: " + strings.Join(env.ExportFormats, ", "),
+		}},
+		Usage: "Export the environment of your apps",
+		Description: `Export the environment variables, the values are escaped to be read back:
+
+    $ scalingo -a myapp env-export > .env
+    $ scalingo -a myapp env-export --format json > env.json
+    $ eval "$(scalingo -a myapp env-export --format shell)"
+
+    # See also commands 'env' and 'env-import'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "env-export")
+				return
+			}
+			err := env.Export(currentApp, c.String("format"))
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "env-export")
+		},
+	}
+
+	envImportCommand = cli.Command{
+		Name:     "env-import",
+		Category: "Environment",
+		Flags: []cli.Flag{appFlag,
+			cli.BoolFlag{Name: "prune", Usage: "Remove the variables missing from the file"},
+			cli.BoolFlag{Name: "dry-run", Usage: "Only display the changes"},
+			cli.BoolFlag{Name: "yes, y", Usage: "Apply the changes without confirmation"},
+		},
+		Usage: "Import environment variables from a file",
+		Description: `Set the variables of a dotenv or JSON file ('-' reads the standard input),
+the added, changed and unchanged variables are displayed before being applied:
+
+    $ scalingo -a myapp env-import .env
+    $ scalingo -a myapp env-export | scalingo -a myapp-staging env-import --yes -
+
+With --prune, the variables of the application missing from the file are removed.
+The variables provided by the addons (SCALINGO_*_URL) are never modified.
+
+    # See also commands 'env-export' and 'env-set'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 1 {
+				cli.ShowCommandHelp(c, "env-import")
+				return
+			}
+			err := env.Import(currentApp, c.Args()[0], env.ImportOpts{
+				Prune:  c.Bool("prune"),
+				DryRun: c.Bool("dry-run"),
+				Yes:    c.Bool("yes"),
+			})
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "env-import")
+		},
+	}
+
+	envEditCommand = cli.Command{
+		Name:     "env-edit",
+		Category: "Environment",
+		Flags: []cli.Flag{appFlag,
+			cli.BoolFlag{Name: "yes, y", Usage: "Apply the changes without confirmation"},
+		},
+		Usage: "Edit the environment of your apps in your editor",
+		Description: `Open the environment variables in your editor ($VISUAL or $EDITOR), the
+changes are displayed and applied once the file is closed:
+
+    $ scalingo -a myapp env-edit
+
+The variables provided by the addons are commented, they can't be modified.
+If the file can't be parsed, the editor is opened again with the error written
+above the faulty line.
+
+    # See also commands 'env-set', 'env-unset' and 'env-import'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "env-edit")
+				return
+			}
+			err := env.Edit(currentApp, env.EditOpts{Yes: c.Bool("yes")})
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "env-edit")
+		},
+	}
+
+	envDiffCommand = cli.Command{
+		Name:     "env-diff",
+		Category: "Environment",
+		Flags: []cli.Flag{
+			cli.BoolFlag{Name: "reveal", Usage: "Display the values of the secrets"},
+		},
+		Usage: "Compare the environments of two apps",
+		Description: `Display the variables only defined in one of the applications and the ones
+with different values, the secrets are masked unless --reveal is given:
+
+    $ scalingo env-diff myapp-staging myapp
+
+The variables provided by the addons (SCALINGO_*_URL) are not compared.
+
+    # See also commands 'env' and 'env-copy'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			if len(c.Args()) != 2 {
+				cli.ShowCommandHelp(c, "env-diff")
+				return
+			}
+			err := env.Diff(c.Args()[0], c.Args()[1], c.Bool("reveal"))
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "env-diff")
+		},
+	}
+
+	envCopyCommand = cli.Command{
+		Name:     "env-copy",
+		Category: "Environment",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "from", Usage: "Application to copy the variables from"},
+			cli.StringFlag{Name: "to", Usage: "Application to copy the variables to"},
+			cli.StringFlag{Name: "only", Usage: "Only copy the variables whose name matches this regular expression"},
+			cli.StringFlag{Name: "exclude", Usage: "Do not copy the variables whose name matches this regular expression"},
+			cli.BoolFlag{Name: "dry-run", Usage: "Only display the changes"},
+			cli.BoolFlag{Name: "yes, y", Usage: "Apply the changes without confirmation"},
+		},
+		Usage: "Copy environment variables between apps",
+		Description: `Copy the variables of an application to another one, in a single operation:
+
+    $ scalingo env-copy --from myapp --to myapp-staging
+    $ scalingo env-copy --from myapp --to myapp-staging --only '^STRIPE_' --exclude '_LIVE_'
+
+The variables provided by the addons (SCALINGO_*_URL) are never copied.
+
+    # See also commands 'env-diff' and 'env-import'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			if len(c.Args()) != 0 || c.String("from") == "" || c.String("to") == "" {
+				cli.ShowCommandHelp(c, "env-copy")
+				return
+			}
+			opts := env.CopyOpts{
+				From:    c.String("from"),
+				To:      c.String("to"),
+				Only:    c.String("only"),
+				Exclude: c.String("exclude"),
+				DryRun:  c.Bool("dry-run"),
+				Yes:     c.Bool("yes"),
+			}
+			err := env.Copy(opts)
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "env-copy")
+		},
+	}
+
+	envHistoryCommand = cli.Command{
+		Name:     "env-history",
+		Category: "Environment",
+		Flags: []cli.Flag{appFlag,
+			cli.StringFlag{Name: "since", Usage: "Only display the changes after this date"},
+			cli.StringFlag{Name: "until", Usage: "Only display the changes before this date"},
+			cli.BoolFlag{Name: "reveal", Usage: "Display the values of the secrets"},
+		},
+		Usage: "Display the changes of the environment of your apps",
+		Description: `Display who modified the environment variables and when, from the timeline
+of the application. The secrets are masked unless --reveal is given:
+
+    $ scalingo -a myapp env-history
+    $ scalingo -a myapp env-history STRIPE_KEY
+    $ scalingo -a myapp env-history --since 2018-01-01 --until '2018-02-01 12:00'
+
+The dates are YYYY-MM-DD, 'YYYY-MM-DD HH:MM' or RFC3339 timestamps.
+
+    # See also commands 'env' and 'timeline'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) > 1 {
+				cli.ShowCommandHelp(c, "env-history")
+				return
+			}
+			opts := env.HistoryOpts{
+				Name:   c.Args().First(),
+				Reveal: c.Bool("reveal"),
+			}
+			var err error
+			if c.String("since") != "" {
+				opts.Since, err = utils.ParseDate(c.String("since"))
+				if err != nil {
+					errorQuit(err)
+				}
+			}
+			if c.String("until") != "" {
+				opts.Until, err = utils.ParseDate(c.String("until"))
+				if err != nil {
+					errorQuit(err)
+				}
+			}
+			err = env.History(currentApp, opts)
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "env-history")
+			autocomplete.EnvUnsetAutoComplete(c)
+		},
+	}
 )
+
+func envRestartOpts(c *cli.Context) env.RestartOpts {
+	scope := c.String("restart-scope")
+	opts := env.RestartOpts{
+		Restart:         c.Bool("restart") || scope != "",
+		RevertOnFailure: c.Bool("revert-on-failure"),
+	}
+	if scope != "" && scope != "all" {
+		opts.Scope = strings.Split(scope, ",")
+	}
+	return opts
+}
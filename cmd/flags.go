@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/Scalingo/cli/crypto/sshkeys"
 	"github.com/Scalingo/cli/debug"
+	netssh "github.com/Scalingo/cli/net/ssh"
 	"github.com/urfave/cli"
 )
 
@@ -17,19 +19,28 @@ var (
 	addonFlag = cli.StringFlag{
 		Name:  "addon",
 		Value: "<addon_id>",
-		Usage: "ID of the current addon",
+		Usage: "ID of the current addon (default $SCALINGO_ADDON)",
+	}
+	envVarFlag = cli.StringFlag{
+		Name:  "env-var",
+		Usage: "Name of the environment variable containing the connection URL of the addon",
+	}
+	knownHostsFlag = cli.StringFlag{
+		Name:  "known-hosts",
+		Usage: "Known hosts file used to verify the SSH server (default $HOME/.ssh/known_hosts)",
+	}
+	insecureHostKeyFlag = cli.BoolFlag{
+		Name:  "insecure-skip-host-key",
+		Usage: "Do not verify the host key of the SSH server",
+	}
+	identityFlag = cli.StringFlag{
+		Name:  "identity, i",
+		Usage: "SSH Private Key",
 	}
 )
 
 func addonName(c *cli.Context) string {
-	var addonName string
-	if c.GlobalString("addon") != "<addon_id>" {
-		addonName = c.GlobalString("addon")
-	} else if c.String("addon") != "<addon_id>" {
-		addonName = c.String("addon")
-	} else if os.Getenv("SCALINGO_ADDON") != "" {
-		addonName = os.Getenv("SCALINGO_ADDON")
-	}
+	addonName := optionalAddonName(c)
 	if addonName == "" {
 		fmt.Println("Unable to find the addon name, please use --addon flag.")
 		os.Exit(1)
@@ -38,3 +49,43 @@ func addonName(c *cli.Context) string {
 	debug.Println("[ADDON] Addon name is", addonName)
 	return addonName
 }
+
+// optionalAddonName returns the addon given with the --addon flag or the
+// SCALINGO_ADDON environment variable, or an empty string if there is none.
+// The addon coming from the environment is displayed on stderr, as it is
+// easily forgotten.
+func optionalAddonName(c *cli.Context) string {
+	var addon string
+	if c.GlobalString("addon") != "<addon_id>" && c.GlobalString("addon") != "" {
+		addon = c.GlobalString("addon")
+	} else if c.String("addon") != "<addon_id>" && c.String("addon") != "" {
+		addon = c.String("addon")
+	} else {
+		addon = os.Getenv("SCALINGO_ADDON")
+	}
+	if addon != "" && addon == os.Getenv("SCALINGO_ADDON") {
+		fmt.Fprintf(os.Stderr, "Using the addon %s from the SCALINGO_ADDON environment variable\n", addon)
+	}
+	return addon
+}
+
+// sshIdentity returns the SSH key given with the --identity flag, the SSH
+// agent if it is running, or the default key.
+func sshIdentity(c *cli.Context) string {
+	if c.String("identity") != "" {
+		return c.String("identity")
+	}
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		return "ssh-agent"
+	}
+	return sshkeys.DefaultKeyPath
+}
+
+// hostKeyOpts returns how the host key of the SSH server is verified, from
+// the --known-hosts and --insecure-skip-host-key flags.
+func hostKeyOpts(c *cli.Context) netssh.HostKeyOpts {
+	return netssh.HostKeyOpts{
+		KnownHostsFile:     c.String("known-hosts"),
+		InsecureSkipVerify: c.Bool("insecure-skip-host-key"),
+	}
+}
@@ -12,8 +12,10 @@ var (
 		Name:     "mongo-console",
 		Category: "Databases",
 		Usage:    "Run an interactive console with your MongoDB addon",
-		Flags: []cli.Flag{appFlag,
+		Flags: []cli.Flag{appFlag, addonFlag, envVarFlag,
 			cli.StringFlag{Name: "size, s", Value: "", Usage: "Size of the container"},
+			cli.BoolFlag{Name: "local", Usage: "Run the mongo client installed locally through an encrypted tunnel"},
+			identityFlag, knownHostsFlag, insecureHostKeyFlag,
 		},
 		Description: ` Run an interactive console with your MongoDB addon.
 
@@ -26,18 +28,40 @@ var (
    You can read more about container sizes here:
    http://doc.scalingo.com/internals/container-sizes.html
 
+   The --local flag runs the 'mongo' client installed on your computer
+   instead of starting a one-off container. The connection goes through an
+   SSH-encrypted tunnel (see 'db-tunnel'), closed when the client exits. The
+   SSH key and the host key of the SSH server are handled as for 'db-tunnel',
+   the '--identity', '--known-hosts' and '--insecure-skip-host-key' flags work
+   the same way.
+
+    scalingo --app myapp mongo-console --local
+
+   When the application has several addons of this kind, the one to use can be
+   chosen with its ID (--addon) or with the name of the environment variable
+   containing its connection URL (--env-var). Otherwise you are asked to choose.
+
+    scalingo --app myapp mongo-console --env-var SCALINGO_MONGO_URL_2
+
     # See also 'redis-console' and 'mysql-console'
 `,
 		Before: AuthenticateHook,
 		Action: func(c *cli.Context) {
 			currentApp := appdetect.CurrentApp(c)
-			opts := db.MongoConsoleOpts{
-				App:  currentApp,
-				Size: c.String("s"),
+			opts := db.ConsoleOpts{
+				App:   currentApp,
+				Size:  c.String("s"),
+				Local: c.Bool("local"),
+				Addon: db.AddonSelector{
+					AddonID: optionalAddonName(c),
+					EnvVar:  c.String("env-var"),
+				},
+				Identity: sshIdentity(c),
+				HostKey:  hostKeyOpts(c),
 			}
 			if len(c.Args()) != 0 {
 				cli.ShowCommandHelp(c, "mongo-console")
-			} else if err := db.MongoConsole(opts); err != nil {
+			} else if err := db.Console(db.MongoConsole, opts); err != nil {
 				errorQuit(err)
 			}
 		},
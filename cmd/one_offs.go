@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"github.com/Scalingo/cli/appdetect"
+	"github.com/Scalingo/cli/apps"
+	"github.com/Scalingo/cli/cmd/autocomplete"
+	"github.com/urfave/cli"
+)
+
+var (
+	OneOffsCommand = cli.Command{
+		Name:     "one-offs",
+		Category: "App Management",
+		Usage:    "List the running one-off containers of your app",
+		Flags:    []cli.Flag{appFlag},
+		Description: `List the one-off containers of your application which are still running
+
+   Example
+     scalingo --app my-app one-offs
+
+   The 'Attachable' column indicates if the one-off has been started in
+   detached mode from this computer, in this case it's possible to attach to it
+   with the 'run-attach' command.
+
+   # See also 'run' and 'run-attach'`,
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "one-offs")
+				return
+			}
+
+			err := apps.OneOffs(currentApp)
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "one-offs")
+		},
+	}
+
+	RunAttachCommand = cli.Command{
+		Name:     "run-attach",
+		Category: "App Management",
+		Usage:    "Attach your terminal to a detached one-off container",
+		Flags:    []cli.Flag{appFlag},
+		Description: `Reconnect to a one-off container started with 'run --detached'
+
+   Example
+     scalingo --app my-app run --detached bundle exec rake long:task
+     scalingo --app my-app run-attach one-off-1234
+
+   The container can be designated by its name (as displayed by 'one-offs') or
+   by its ID.
+
+   If the run service does not allow to attach to the container, the logs of
+   the container are followed until it stops, and its exit status is reported.
+
+   # See also 'run' and 'one-offs'`,
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 1 {
+				cli.ShowCommandHelp(c, "run-attach")
+				return
+			}
+
+			err := apps.RunAttach(currentApp, c.Args()[0])
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "run-attach")
+		},
+	}
+)
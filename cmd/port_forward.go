@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Scalingo/cli/appdetect"
+	"github.com/Scalingo/cli/apps"
+	"github.com/Scalingo/cli/cmd/autocomplete"
+	"github.com/urfave/cli"
+	"gopkg.in/errgo.v1"
+)
+
+var (
+	PortForwardCommand = cli.Command{
+		Name:     "port-forward",
+		Category: "App Management",
+		Usage:    "Forward a local port to a port of a one-off container",
+		Flags: []cli.Flag{appFlag,
+			cli.StringFlag{Name: "size, s", Value: "", Usage: "Size of the container"},
+		},
+		Description: `Start a one-off container with your application environment and forward
+   the TCP connections of a local port to a port inside the container.
+
+   Examples
+     scalingo --app my-app port-forward 6060:6060 -- ./bin/server --pprof :6060
+     scalingo --app my-app port-forward 9010 -- java -Dcom.sun.management.jmxremote.port=9010 -jar app.jar
+
+   The argument has the form LOCAL:REMOTE, if only one port is given it is
+   used for both the local and the remote ports. If the local port is already
+   in use, the next available one is used.
+
+   The command given after '--' is started in the container, with the
+   environment variable PORT set to the remote port, its output is displayed
+   on your terminal. When no command is given, the command of the 'web' process
+   type of your Procfile is used.
+
+   The connections are forwarded through the one-off connection thanks to a
+   small Perl agent uploaded in the container. Press Ctrl-C to stop forwarding.
+
+   # See also 'run' and 'db-tunnel'`,
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			args := c.Args()
+			if len(args) == 0 {
+				cli.ShowCommandHelp(c, "port-forward")
+				return
+			}
+
+			localPort, remotePort, err := parsePortMapping(args[0])
+			if err != nil {
+				errorQuit(err)
+			}
+			cmd := args[1:]
+			if len(cmd) > 0 && cmd[0] == "--" {
+				cmd = cmd[1:]
+			}
+
+			err = apps.PortForward(apps.PortForwardOpts{
+				App:        currentApp,
+				LocalPort:  localPort,
+				RemotePort: remotePort,
+				Cmd:        cmd,
+				Size:       c.String("s"),
+			})
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "port-forward")
+		},
+	}
+)
+
+func parsePortMapping(mapping string) (int, int, error) {
+	ports := strings.Split(mapping, ":")
+	if len(ports) > 2 {
+		return 0, 0, errgo.Newf("invalid port mapping '%s', format is LOCAL:REMOTE", mapping)
+	}
+
+	var parsed []int
+	for _, port := range ports {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return 0, 0, errgo.Newf("invalid port '%s' in '%s'", port, mapping)
+		}
+		parsed = append(parsed, p)
+	}
+	if len(parsed) == 1 {
+		return parsed[0], parsed[0], nil
+	}
+	return parsed[0], parsed[1], nil
+}
@@ -8,9 +8,11 @@ import (
 )
 
 var (
-	EnvFlag    = cli.StringSlice([]string{})
-	FilesFlag  = cli.StringSlice([]string{})
-	RunCommand = cli.Command{
+	EnvFlag      = cli.StringSlice([]string{})
+	EnvFileFlag  = cli.StringSlice([]string{})
+	UnsetEnvFlag = cli.StringSlice([]string{})
+	FilesFlag    = cli.StringSlice([]string{})
+	RunCommand   = cli.Command{
 		Name:      "run",
 		ShortName: "r",
 		Category:  "App Management",
@@ -20,6 +22,9 @@ var (
 			cli.StringFlag{Name: "size, s", Value: "", Usage: "Size of the container"},
 			cli.StringFlag{Name: "type, t", Value: "", Usage: "Procfile Type"},
 			cli.StringSliceFlag{Name: "env, e", Value: &EnvFlag, Usage: "Environment variables"},
+			cli.StringSliceFlag{Name: "env-file", Value: &EnvFileFlag, Usage: "Files of environment variables (dotenv format)"},
+			cli.StringSliceFlag{Name: "unset-env", Value: &UnsetEnvFlag, Usage: "Application environment variables to remove from the container"},
+			cli.BoolFlag{Name: "print-env", Usage: "Display the environment of the container without running it"},
 			cli.StringSliceFlag{Name: "file, f", Value: &FilesFlag, Usage: "Files to upload"},
 			cli.BoolFlag{Name: "silent", Usage: "Do not output anything on stderr"},
 		},
@@ -37,7 +42,8 @@ var (
    container will be started and you'll get back your terminal immediately. Its
    output will be accessible from the logs of the application (command 'logs')
    You can see if the task is still running with the command 'ps' which will
-   display the list of the running containers.
+   display the list of the running containers. The command 'run-attach' lets you
+   reconnect your terminal to it.
 
    The --size flag makes it easy to specify the size of the container you want
    to run. Each container size has different price and performance. You can read
@@ -67,6 +73,27 @@ var (
    Example
      scalingo run -e VARIABLE=VALUE -e VARIABLE2=OTHER_VALUE rails console
 
+   When you have a lot of variables to inject, they can be read from a file
+   with the flag '--env-file', it follows the dotenv syntax: comments, 'export'
+   prefix, single or double quoted values, escape sequences and multiline values
+   are supported. The flag can be used multiple times, the variables defined with
+   '-e' take precedence over the ones defined in files.
+
+   Example
+     scalingo run --env-file .env --env-file .env.migration rake db:migrate
+
+   A variable of your application environment can be hidden from the one-off
+   container with the flag '--unset-env'.
+
+   Example
+     scalingo run --unset-env SENTRY_DSN rake db:migrate
+
+   Before starting the container, you can check the environment it will receive
+   with the flag '--print-env', secret values are masked.
+
+   Example
+     scalingo run --env-file .env --unset-env SENTRY_DSN --print-env
+
    Furthermore, you may want to upload a file, like a database dump or anything
    useful to you. The option '-f' has been built for this purpose, you can even
    upload multiple files if you wish. You will be able to find these files in the
@@ -83,11 +110,14 @@ var (
 				Size:     c.String("s"),
 				Type:     c.String("t"),
 				CmdEnv:   c.StringSlice("e"),
+				EnvFiles: c.StringSlice("env-file"),
+				UnsetEnv: c.StringSlice("unset-env"),
+				PrintEnv: c.Bool("print-env"),
 				Files:    c.StringSlice("f"),
 				Silent:   c.Bool("silent"),
 				Detached: c.Bool("detached"),
 			}
-			if (len(c.Args()) == 0 && c.String("t") == "") || (len(c.Args()) > 0 && c.String("t") != "") {
+			if (len(c.Args()) == 0 && c.String("t") == "" && !opts.PrintEnv) || (len(c.Args()) > 0 && c.String("t") != "") {
 				cli.ShowCommandHelp(c, "run")
 			} else if err := apps.Run(opts); err != nil {
 				errorQuit(err)
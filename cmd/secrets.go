@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"github.com/Scalingo/cli/appdetect"
+	"github.com/Scalingo/cli/cmd/autocomplete"
+	"github.com/Scalingo/cli/env"
+	"github.com/Scalingo/cli/env/secrets"
+	"github.com/urfave/cli"
+)
+
+var (
+	secretsFileFlag = cli.StringFlag{
+		Name:  "file, f",
+		Value: secrets.DefaultFile,
+		Usage: "Path of the secrets file",
+	}
+
+	secretsKeygenCommand = cli.Command{
+		Name:     "secrets-keygen",
+		Category: "Environment",
+		Usage:    "Generate your key to encrypt and decrypt secrets files",
+		Description: `Generate your key pair, the private key is written in the configuration
+directory of the CLI and the public key is displayed:
+
+    $ scalingo secrets-keygen
+
+Add the public key to the recipients of a secrets file, then a recipient who
+already has access runs 'scalingo secrets-encrypt' to share the file with you.
+In CI, the private key can be given with the SCALINGO_SECRETS_KEY environment
+variable.
+
+    # See also commands 'secrets-encrypt' and 'secrets-push'`,
+
+		Action: func(c *cli.Context) {
+			if len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "secrets-keygen")
+				return
+			}
+			err := env.SecretsKeygen()
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "secrets-keygen")
+		},
+	}
+
+	secretsEncryptCommand = cli.Command{
+		Name:     "secrets-encrypt",
+		Category: "Environment",
+		Flags:    []cli.Flag{secretsFileFlag},
+		Usage:    "Encrypt a secret in the secrets file",
+		Description: `Encrypt a variable in the secrets file (scalingo.secrets.yml by default), which
+can be committed with the code of the application. The value is typed without
+being displayed, or read from the standard input:
+
+    $ scalingo secrets-encrypt STRIPE_KEY
+    $ cat credentials.json | scalingo secrets-encrypt GOOGLE_CREDENTIALS
+
+The values are encrypted locally for the recipients listed in the file, the
+file is created with your public key if it doesn't exist. Without variable,
+all the secrets are encrypted again with a new key, to share the file with the
+recipients added to the file or to revoke the access of the removed ones:
+
+    $ scalingo secrets-encrypt
+
+    # See also commands 'secrets-keygen', 'secrets-edit' and 'secrets-push'`,
+
+		Action: func(c *cli.Context) {
+			if len(c.Args()) > 1 {
+				cli.ShowCommandHelp(c, "secrets-encrypt")
+				return
+			}
+			err := env.SecretsEncrypt(c.String("file"), c.Args().First())
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "secrets-encrypt")
+		},
+	}
+
+	secretsDecryptCommand = cli.Command{
+		Name:     "secrets-decrypt",
+		Category: "Environment",
+		Flags:    []cli.Flag{secretsFileFlag},
+		Usage:    "Display the decrypted secrets",
+		Description: `Display the value of a secret, or all of them in the dotenv format. The
+secrets are only written to the standard output:
+
+    $ scalingo secrets-decrypt STRIPE_KEY
+    $ scalingo secrets-decrypt
+
+    # See also commands 'secrets-encrypt' and 'secrets-edit'`,
+
+		Action: func(c *cli.Context) {
+			if len(c.Args()) > 1 {
+				cli.ShowCommandHelp(c, "secrets-decrypt")
+				return
+			}
+			err := env.SecretsDecrypt(c.String("file"), c.Args().First())
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "secrets-decrypt")
+		},
+	}
+
+	secretsEditCommand = cli.Command{
+		Name:     "secrets-edit",
+		Category: "Environment",
+		Flags:    []cli.Flag{secretsFileFlag},
+		Usage:    "Edit the secrets in your editor",
+		Description: `Open the decrypted secrets in your editor ($VISUAL or $EDITOR), they are
+encrypted again once the file is closed:
+
+    $ scalingo secrets-edit
+
+The temporary file is created in a memory-backed directory (/dev/shm or
+$XDG_RUNTIME_DIR) so that the secrets are never written on the disk, it is
+overwritten and removed afterwards.
+
+    # See also commands 'secrets-encrypt' and 'secrets-push'`,
+
+		Action: func(c *cli.Context) {
+			if len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "secrets-edit")
+				return
+			}
+			err := env.SecretsEdit(c.String("file"))
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "secrets-edit")
+		},
+	}
+
+	secretsPushCommand = cli.Command{
+		Name:     "secrets-push",
+		Category: "Environment",
+		Flags: []cli.Flag{appFlag, secretsFileFlag,
+			cli.BoolFlag{Name: "dry-run", Usage: "Only display the changes"},
+			cli.BoolFlag{Name: "yes, y", Usage: "Apply the changes without confirmation"},
+		},
+		Usage: "Set the secrets in the environment of your apps",
+		Description: `Decrypt the secrets in memory and set them in the environment of the
+application, the changes are displayed before being applied:
+
+    $ scalingo -a myapp secrets-push
+    $ scalingo -a myapp-staging secrets-push --file staging.secrets.yml --yes
+
+The variables which are not in the file are left untouched.
+
+    # See also commands 'secrets-encrypt' and 'env-import'`,
+
+		Before: AuthenticateHook,
+		Action: func(c *cli.Context) {
+			currentApp := appdetect.CurrentApp(c)
+			if len(c.Args()) != 0 {
+				cli.ShowCommandHelp(c, "secrets-push")
+				return
+			}
+			err := env.SecretsPush(currentApp, c.String("file"), env.SecretsPushOpts{
+				DryRun: c.Bool("dry-run"),
+				Yes:    c.Bool("yes"),
+			})
+			if err != nil {
+				errorQuit(err)
+			}
+		},
+		BashComplete: func(c *cli.Context) {
+			autocomplete.CmdFlagsAutoComplete(c, "secrets-push")
+		},
+	}
+)
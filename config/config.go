@@ -28,8 +28,14 @@ type Config struct {
 	ConfigDir            string
 	AuthFile             string
 	LogFile              string
-	logFile              *os.File
-	Logger               *log.Logger
+	// ScalingoSecretPatterns are comma-separated patterns of the names of the
+	// variables masked in addition to the default ones
+	ScalingoSecretPatterns string
+	// ScalingoSecretsKey is the private key decrypting the secrets files, it
+	// is read from the configuration directory if empty
+	ScalingoSecretsKey string
+	logFile            *os.File
+	Logger             *log.Logger
 }
 
 var (
@@ -1,33 +1,55 @@
 package db
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/debug"
 	"github.com/briandowns/spinner"
 	"github.com/cheggaaa/pb"
 	errgo "gopkg.in/errgo.v1"
 )
 
+const (
+	// downloadRetries is the number of times a download is resumed after a
+	// failure before giving up
+	downloadRetries    = 5
+	downloadRetryDelay = 2 * time.Second
+	downloadMaxDelay   = 1 * time.Minute
+	partFileExtension  = ".part"
+)
+
 type DownloadBackupOpts struct {
 	Output string
 	Silent bool
+	// Checksum is the expected checksum of the archive, as
+	// 'sha256:<hex>', 'sha1:<hex>' or 'md5:<hex>' (sha256 if no algorithm
+	// is given)
+	Checksum string
 }
 
+// DownloadBackup downloads the archive of a backup. The download goes to a
+// '.part' file which is renamed once the archive is complete and verified,
+// an interrupted download is resumed from this file with an HTTP Range
+// request, including when the command is run again.
 func DownloadBackup(app, addon, backupID string, opts DownloadBackupOpts) error {
 	// Output management (manage -s and -o - flags)
-	var fileWriter io.Writer
 	var logWriter io.Writer
 	writeToStdout := false
 
 	if opts.Output == "-" {
 		logWriter = os.Stderr
-		fileWriter = os.Stdout
 		writeToStdout = true
 	} else {
 		logWriter = os.Stdout
@@ -37,6 +59,11 @@ func DownloadBackup(app, addon, backupID string, opts DownloadBackupOpts) error
 		logWriter = ioutil.Discard
 	}
 
+	checksum, err := parseChecksum(opts.Checksum)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
 	// Start a spinner when loading metadatas
 	spinner := spinner.New(spinner.CharSets[11], 100*time.Millisecond)
 	spinner.Suffix = " Preparing download"
@@ -47,12 +74,21 @@ func DownloadBackup(app, addon, backupID string, opts DownloadBackupOpts) error
 	client := config.ScalingoClient()
 	backup, err := client.BackupShow(app, addon, backupID)
 	if err != nil {
+		spinner.Stop()
 		return errgo.Notef(err, "fail to get backup")
 	}
 
+	download := &backupDownload{
+		app: app, addon: addon, backupID: backupID,
+		size:     int64(backup.Size),
+		checksum: checksum,
+	}
+
 	// Generate the filename and file writer
 	filepath := ""
-	if !writeToStdout { // No need to generate the filename nor the file writer if we're outputing to stdout
+	if writeToStdout {
+		download.writer = os.Stdout
+	} else {
 		filepath = fmt.Sprintf("%s.tar.gz", backup.Name) // Default filename
 		if opts.Output != "" {                           // If the Output flag was defined
 			if isDir(opts.Output) { // If it's a directory use the default filename in this directory
@@ -61,46 +97,254 @@ func DownloadBackup(app, addon, backupID string, opts DownloadBackupOpts) error
 				filepath = opts.Output
 			}
 		}
-		// Open the output file
-		f, err := os.OpenFile(filepath, os.O_RDWR|os.O_CREATE, 0644)
+		// Open the partial file, the download restarts where it stopped if it exists
+		f, err := os.OpenFile(filepath+partFileExtension, os.O_RDWR|os.O_CREATE, 0644)
 		if err != nil {
+			spinner.Stop()
 			return errgo.Notef(err, "fail to open file")
 		}
-		fileWriter = f // Set the output file as the fileWriter
-	}
-
-	// Get the pre-signed download URL
-	downloadURL, err := client.BackupDownloadURL(app, addon, backupID)
-	if err != nil {
-		return errgo.Notef(err, "fail to get backup download URL")
-	}
+		defer f.Close()
+		download.file = f
+		download.writer = f
 
-	// Start the download
-	resp, err := http.Get(downloadURL)
-	if err != nil {
-		return errgo.Notef(err, "fail to start download")
+		err = download.resume()
+		if err != nil {
+			spinner.Stop()
+			return errgo.Mask(err)
+		}
 	}
-	defer resp.Body.Close()
 	spinner.Stop()
+
 	// Stop the spinner, start the progress bar
-	bar := pb.New64(int64(backup.Size)).SetUnits(pb.U_BYTES)
+	bar := pb.New64(download.size).SetUnits(pb.U_BYTES)
 	bar.Output = logWriter
+	bar.Set64(download.offset)
+	if download.offset > 0 {
+		fmt.Fprintf(logWriter, "-----> Resuming download at %d bytes\n", download.offset)
+	}
 	bar.Start()
-	reader := bar.NewProxyReader(resp.Body) // Did I tell you this library is awesome ?
-	_, err = io.Copy(fileWriter, reader)
+	download.bar = bar
+
+	err = download.run()
 	if writeToStdout { // If we were writing the file to Stdout do not print the filepath at the end
 		bar.Finish()
-	} else {
+	} else if err == nil {
 		bar.FinishPrint(fmt.Sprintf("===> %s", filepath)) // If we weren't writing to stdout append the filepath
+	} else {
+		bar.Finish()
 	}
-
 	if err != nil {
 		return errgo.Notef(err, "fail to download file")
 	}
 
+	err = download.verify()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	if !writeToStdout {
+		download.file.Close()
+		err = os.Rename(filepath+partFileExtension, filepath)
+		if err != nil {
+			return errgo.Notef(err, "fail to move the downloaded file")
+		}
+	}
+	return nil
+}
+
+type backupDownload struct {
+	app, addon, backupID string
+	size                 int64
+	checksum             *backupChecksum
+
+	// file is nil when the backup is written to stdout
+	file   *os.File
+	writer io.Writer
+	offset int64
+	bar    *pb.ProgressBar
+}
+
+// resume prepares the download to continue after the content of the partial
+// file, which is fed to the checksum
+func (d *backupDownload) resume() error {
+	stat, err := d.file.Stat()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	d.offset = stat.Size()
+	if d.size > 0 && d.offset > d.size {
+		// The partial file doesn't belong to this backup
+		return d.restart()
+	}
+	if d.checksum != nil && d.offset > 0 {
+		_, err = io.Copy(d.checksum.hash, io.LimitReader(d.file, d.offset))
+		if err != nil {
+			return errgo.Notef(err, "fail to read the partial file")
+		}
+	}
+	_, err = d.file.Seek(d.offset, io.SeekStart)
+	return errgo.Mask(err)
+}
+
+// restart empties the partial file when the server doesn't support range requests
+func (d *backupDownload) restart() error {
+	if d.file == nil {
+		return errgo.New("the server doesn't support resuming the download")
+	}
+	err := d.file.Truncate(0)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	_, err = d.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if d.checksum != nil {
+		d.checksum.hash.Reset()
+	}
+	d.offset = 0
+	if d.bar != nil {
+		d.bar.Set64(0)
+	}
+	return nil
+}
+
+// run downloads the remaining part of the archive, retrying with an
+// exponential backoff as long as the download progresses
+func (d *backupDownload) run() error {
+	delay := downloadRetryDelay
+	retries := 0
+	for {
+		if d.size > 0 && d.offset >= d.size {
+			return nil
+		}
+
+		offset := d.offset
+		done, err := d.fetch()
+		if err == nil && done {
+			return nil
+		}
+		if err == nil {
+			err = errgo.New("the connection was closed before the end of the download")
+		}
+		if d.offset > offset {
+			// Some data has been received, the connection was not hopeless
+			retries = 0
+			delay = downloadRetryDelay
+		}
+		retries++
+		if retries > downloadRetries {
+			return errgo.Mask(err)
+		}
+		debug.Printf("Download failed at %d bytes: %v, retrying in %v (%d/%d)\n", d.offset, err, delay, retries, downloadRetries)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > downloadMaxDelay {
+			delay = downloadMaxDelay
+		}
+	}
+}
+
+// fetch requests the archive from the current offset and writes it, done is
+// true if the end of the archive has been reached
+func (d *backupDownload) fetch() (bool, error) {
+	// The pre-signed URL may have expired since the previous attempt
+	client := config.ScalingoClient()
+	downloadURL, err := client.BackupDownloadURL(d.app, d.addon, d.backupID)
+	if err != nil {
+		return false, errgo.Notef(err, "fail to get backup download URL")
+	}
+
+	req, err := http.NewRequest("GET", downloadURL, nil)
+	if err != nil {
+		return false, errgo.Mask(err)
+	}
+	if d.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.offset))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, errgo.Notef(err, "fail to start download")
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && d.size <= 0:
+		// Nothing left to download
+		return true, nil
+	case resp.StatusCode == http.StatusOK:
+		if d.offset > 0 {
+			debug.Println("Range request not supported, restarting the download")
+			err = d.restart()
+			if err != nil {
+				return false, errgo.Mask(err)
+			}
+		}
+	default:
+		return false, errgo.Newf("invalid response from the storage: %s", resp.Status)
+	}
+
+	writer := d.writer
+	if d.checksum != nil {
+		writer = io.MultiWriter(writer, d.checksum.hash)
+	}
+	n, err := io.Copy(writer, d.bar.NewProxyReader(resp.Body))
+	d.offset += n
+	if err != nil {
+		return false, errgo.Mask(err)
+	}
+	return d.size <= 0 || d.offset >= d.size, nil
+}
+
+// verify checks the size and the checksum of the downloaded archive
+func (d *backupDownload) verify() error {
+	if d.size > 0 && d.offset != d.size {
+		return errgo.Newf("the downloaded archive is %d bytes long, %d bytes were expected", d.offset, d.size)
+	}
+	if d.checksum != nil {
+		sum := hex.EncodeToString(d.checksum.hash.Sum(nil))
+		if sum != d.checksum.expected {
+			return errgo.Newf("invalid %s checksum of the downloaded archive: %s, expected %s", d.checksum.algorithm, sum, d.checksum.expected)
+		}
+	}
 	return nil
 }
 
+type backupChecksum struct {
+	algorithm string
+	expected  string
+	hash      hash.Hash
+}
+
+func parseChecksum(checksum string) (*backupChecksum, error) {
+	if checksum == "" {
+		return nil, nil
+	}
+	algorithm := "sha256"
+	expected := checksum
+	if i := strings.Index(checksum, ":"); i != -1 {
+		algorithm, expected = strings.ToLower(checksum[:i]), checksum[i+1:]
+	}
+
+	res := &backupChecksum{algorithm: algorithm, expected: strings.ToLower(expected)}
+	switch algorithm {
+	case "sha256":
+		res.hash = sha256.New()
+	case "sha1":
+		res.hash = sha1.New()
+	case "md5":
+		res.hash = md5.New()
+	default:
+		return nil, errgo.Newf("unsupported checksum algorithm '%s', use sha256, sha1 or md5", algorithm)
+	}
+	if _, err := hex.DecodeString(res.expected); err != nil || len(res.expected) != 2*res.hash.Size() {
+		return nil, errgo.Newf("invalid %s checksum '%s'", algorithm, expected)
+	}
+	return res, nil
+}
+
 // isDir returns true if it's a valid path to a directory, false otherwise
 func isDir(path string) bool {
 	a, err := os.Open(path)
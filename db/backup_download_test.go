@@ -0,0 +1,27 @@
+package db
+
+import "testing"
+
+func TestParseChecksum(t *testing.T) {
+	cases := map[string]string{
+		"sha256:2C26B46B68FFC68FF99B453C1D30413413422D706483BFA0F98A5E886266E7AE": "sha256",
+		"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae":        "sha256",
+		"md5:acbd18db4cc2f85cedef654fccc4a4d8":                                    "md5",
+	}
+	for checksum, algorithm := range cases {
+		res, err := parseChecksum(checksum)
+		if err != nil {
+			t.Fatal(checksum, err)
+		}
+		if res.algorithm != algorithm {
+			t.Fatalf("%s: expected %s, got %s", checksum, algorithm, res.algorithm)
+		}
+	}
+
+	for _, checksum := range []string{"crc32:8c736521", "sha256:acbd18db4cc2f85cedef654fccc4a4d8", "md5:not-hexadecimal-not-hexadecim"} {
+		_, err := parseChecksum(checksum)
+		if err == nil {
+			t.Fatalf("%s: expected an error", checksum)
+		}
+	}
+}
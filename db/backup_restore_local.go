@@ -0,0 +1,413 @@
+package db
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Scalingo/cli/debug"
+	errgo "gopkg.in/errgo.v1"
+)
+
+// DefaultRestoreConfigFile is the configuration of the local restores read
+// from the current directory when no file is given.
+const DefaultRestoreConfigFile = "scalingo-restore.json"
+
+type dumpFormat string
+
+const (
+	dumpFormatPgCustom  dumpFormat = "PostgreSQL custom dump"
+	dumpFormatSQL       dumpFormat = "plain SQL dump"
+	dumpFormatMongoDump dumpFormat = "mongodump directory"
+	dumpFormatRDB       dumpFormat = "Redis RDB file"
+)
+
+type RestoreLocalOpts struct {
+	// Target is the URL of the local database, or the path of the RDB file
+	// for a Redis backup
+	Target string
+	// Config is the path of the file declaring the anonymisation hooks
+	Config string
+}
+
+// RestoreConfig declares the SQL hooks applied to the database once the
+// backup is restored:
+//
+//	{
+//	  "anonymize": [
+//	    {"table": "users", "column": "email", "value": "'user' || id || '@example.com'"},
+//	    {"table": "users", "column": "phone"}
+//	  ],
+//	  "after_restore": ["DELETE FROM sessions"]
+//	}
+//
+// The value of an anonymized column is an SQL expression, NULL by default.
+type RestoreConfig struct {
+	Anonymize    []AnonymizedColumn `json:"anonymize"`
+	AfterRestore []string           `json:"after_restore"`
+}
+
+type AnonymizedColumn struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Value  string `json:"value"`
+}
+
+// statements returns the SQL statements of the hooks, in their execution order
+func (c RestoreConfig) statements() []string {
+	var statements []string
+	for _, column := range c.Anonymize {
+		value := column.Value
+		if value == "" {
+			value = "NULL"
+		}
+		statements = append(statements, fmt.Sprintf("UPDATE %s SET %s = %s;", column.Table, column.Column, value))
+	}
+	for _, statement := range c.AfterRestore {
+		statement = strings.TrimSpace(statement)
+		if !strings.HasSuffix(statement, ";") {
+			statement += ";"
+		}
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// RestoreBackupLocally downloads a backup, extracts it and restores it in a
+// local database with the tool matching the format of the dump.
+func RestoreBackupLocally(app, addon, backupID string, opts RestoreLocalOpts) error {
+	config, err := readRestoreConfig(opts.Config)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	dir, err := ioutil.TempDir("", "scalingo-backup")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "backup.tar.gz")
+	err = DownloadBackup(app, addon, backupID, DownloadBackupOpts{Output: archive})
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	extractDir := filepath.Join(dir, "backup")
+	err = extractTarGz(archive, extractDir)
+	if err != nil {
+		return errgo.Notef(err, "fail to extract the backup")
+	}
+	os.Remove(archive)
+
+	format, dumpPath, err := detectDumpFormat(extractDir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	fmt.Printf("-----> Restoring %s into %s\n", format, displayTarget(opts.Target))
+
+	if format == dumpFormatRDB {
+		if len(config.statements()) > 0 {
+			return errgo.New("anonymisation hooks are only supported for SQL databases")
+		}
+		return restoreRDB(dumpPath, opts.Target)
+	}
+
+	target, err := url.Parse(opts.Target)
+	if err != nil || target.Scheme == "" {
+		return errgo.Newf("the target '%s' is not a database URL", opts.Target)
+	}
+
+	switch format {
+	case dumpFormatPgCustom:
+		if !isPostgreSQL(target) {
+			return errgo.Newf("a %s can only be restored in a PostgreSQL database", format)
+		}
+		err = runLocalTool(nil, nil, "pg_restore", "--no-owner", "--no-privileges", "--clean", "--if-exists", "-d", target.String(), dumpPath)
+	case dumpFormatSQL:
+		err = runSQLFile(target, dumpPath)
+	case dumpFormatMongoDump:
+		if target.Scheme != "mongodb" {
+			return errgo.Newf("a %s can only be restored in a MongoDB database", format)
+		}
+		if len(config.statements()) > 0 {
+			return errgo.New("anonymisation hooks are only supported for SQL databases")
+		}
+		err = runLocalTool(nil, nil, "mongorestore", mongoRestoreArgs(target, dumpPath)...)
+	}
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	statements := config.statements()
+	if len(statements) > 0 {
+		fmt.Printf("-----> Running %d anonymisation statement(s)\n", len(statements))
+		hooksPath := filepath.Join(dir, "hooks.sql")
+		err = ioutil.WriteFile(hooksPath, []byte(strings.Join(statements, "\n")+"\n"), 0600)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		err = runSQLFile(target, hooksPath)
+		if err != nil {
+			return errgo.Notef(err, "fail to run the anonymisation hooks")
+		}
+	}
+
+	fmt.Println("-----> Backup restored")
+	return nil
+}
+
+func readRestoreConfig(path string) (RestoreConfig, error) {
+	var config RestoreConfig
+	if path == "" {
+		if _, err := os.Stat(DefaultRestoreConfigFile); err != nil {
+			return config, nil
+		}
+		path = DefaultRestoreConfigFile
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, errgo.Notef(err, "fail to read the restore configuration")
+	}
+	err = json.Unmarshal(content, &config)
+	if err != nil {
+		return config, errgo.Notef(err, "invalid restore configuration %s", path)
+	}
+	for _, column := range config.Anonymize {
+		if column.Table == "" || column.Column == "" {
+			return config, errgo.Newf("invalid restore configuration %s: 'table' and 'column' are mandatory to anonymize a column", path)
+		}
+	}
+	debug.Println("Restore configuration", path, config)
+	return config, nil
+}
+
+func extractTarGz(archive, dir string) error {
+	fd, err := os.Open(archive)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer fd.Close()
+
+	gzipReader, err := gzip.NewReader(fd)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errgo.Mask(err)
+		}
+
+		path := filepath.Join(dir, header.Name)
+		if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return errgo.Newf("invalid path in the archive: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0700)
+		case tar.TypeReg, tar.TypeRegA:
+			err = extractFile(tarReader, path)
+		default:
+			debug.Println("Ignoring", header.Name, "of type", header.Typeflag)
+		}
+		if err != nil {
+			return errgo.Mask(err)
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer fd.Close()
+	_, err = io.Copy(fd, r)
+	return errgo.Mask(err)
+}
+
+// detectDumpFormat looks for the dump in the extracted backup and returns
+// its format with the path to give to the restore tool.
+func detectDumpFormat(dir string) (dumpFormat, string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", errgo.Mask(err)
+	}
+
+	for _, file := range files {
+		// mongodump writes a directory per database, containing the BSON files
+		if strings.HasSuffix(file, ".bson") {
+			return dumpFormatMongoDump, filepath.Dir(filepath.Dir(file)), nil
+		}
+	}
+
+	for _, file := range files {
+		header, err := readHeader(file, 512)
+		if err != nil {
+			return "", "", errgo.Mask(err)
+		}
+		switch {
+		case bytes.HasPrefix(header, []byte("PGDMP")):
+			return dumpFormatPgCustom, file, nil
+		case bytes.HasPrefix(header, []byte("REDIS")):
+			return dumpFormatRDB, file, nil
+		case strings.HasSuffix(file, ".sql") || isText(header):
+			return dumpFormatSQL, file, nil
+		}
+	}
+	return "", "", errgo.New("no dump with a known format found in the backup")
+}
+
+func readHeader(path string, size int) ([]byte, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	header := make([]byte, size)
+	n, err := io.ReadFull(fd, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+func isText(content []byte) bool {
+	if len(content) == 0 {
+		return false
+	}
+	for _, b := range content {
+		if b == 0 || (b < 0x20 && b != '\n' && b != '\r' && b != '\t') {
+			return false
+		}
+	}
+	return true
+}
+
+func isPostgreSQL(u *url.URL) bool {
+	return u.Scheme == "postgres" || u.Scheme == "postgresql" || u.Scheme == "postgis"
+}
+
+func runSQLFile(target *url.URL, path string) error {
+	if isPostgreSQL(target) {
+		return runLocalTool(nil, nil, "psql", "--quiet", "-v", "ON_ERROR_STOP=1", "-d", target.String(), "-f", path)
+	}
+	if target.Scheme == "mysql" || target.Scheme == "mysql2" {
+		fd, err := os.Open(path)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		defer fd.Close()
+		args, env := mysqlLocalArgs(target)
+		return runLocalTool(fd, env, "mysql", args...)
+	}
+	return errgo.Newf("an SQL dump can only be restored in a PostgreSQL or MySQL database")
+}
+
+func mysqlLocalArgs(u *url.URL) ([]string, []string) {
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host, port = u.Host, "3306"
+	}
+	args := []string{"-h", host, "-P", port, "--protocol=TCP"}
+	var env []string
+	if u.User != nil {
+		args = append(args, "-u", u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			env = append(env, "MYSQL_PWD="+password)
+		}
+	}
+	return append(args, strings.TrimPrefix(u.Path, "/")), env
+}
+
+func mongoRestoreArgs(target *url.URL, dumpDir string) []string {
+	args := []string{"--uri=" + target.String(), "--drop"}
+	// The dump is restored in the database of the target URL, whatever the
+	// name of the database it comes from
+	targetDB := strings.TrimPrefix(target.Path, "/")
+	entries, err := ioutil.ReadDir(dumpDir)
+	if targetDB != "" && err == nil && len(entries) == 1 && entries[0].IsDir() {
+		args = append(args, "--nsFrom="+entries[0].Name()+".*", "--nsTo="+targetDB+".*")
+	}
+	return append(args, "--dir="+dumpDir)
+}
+
+// restoreRDB copies the RDB file where the local Redis server loads it from,
+// a running server can't load it.
+func restoreRDB(dumpPath, target string) error {
+	path := strings.TrimPrefix(target, "file://")
+	if strings.Contains(path, "://") {
+		return errgo.New("a Redis RDB file can't be loaded in a running server, use the path of the RDB file of your local Redis as target (e.g. /var/lib/redis/dump.rdb)")
+	}
+	content, err := ioutil.ReadFile(dumpPath)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	err = ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		return errgo.Notef(err, "fail to write the RDB file")
+	}
+	fmt.Printf("-----> RDB file written to %s, restart your Redis server (stopped before, to not overwrite it) to load it\n", path)
+	return nil
+}
+
+func runLocalTool(stdin io.Reader, env []string, binary string, args ...string) error {
+	binaryPath, err := exec.LookPath(binary)
+	if err != nil {
+		return errgo.Newf("'%s' is needed to restore this backup, it is not installed locally", binary)
+	}
+	debug.Println("Running", binaryPath, args)
+
+	cmd := exec.Command(binaryPath, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	err = cmd.Run()
+	if err != nil {
+		return errgo.Notef(err, "%s failed", binary)
+	}
+	return nil
+}
+
+// displayTarget hides the password of the target
+func displayTarget(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.User == nil {
+		return target
+	}
+	u.User = url.User(u.User.Username())
+	return u.String()
+}
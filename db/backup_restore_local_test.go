@@ -0,0 +1,88 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectDumpFormat(t *testing.T) {
+	cases := map[string]struct {
+		files    map[string]string
+		format   dumpFormat
+		dumpPath string
+	}{
+		"pg custom": {
+			files:    map[string]string{"backup.pgsql": "PGDMP\x01\x0c\x00"},
+			format:   dumpFormatPgCustom,
+			dumpPath: "backup.pgsql",
+		},
+		"plain sql": {
+			files:    map[string]string{"backup.sql": "CREATE TABLE users (id int);\n"},
+			format:   dumpFormatSQL,
+			dumpPath: "backup.sql",
+		},
+		"mongodump": {
+			files:    map[string]string{"dump/mydb/users.bson": "\x10\x00", "dump/mydb/users.metadata.json": "{}"},
+			format:   dumpFormatMongoDump,
+			dumpPath: "dump",
+		},
+		"rdb": {
+			files:    map[string]string{"dump.rdb": "REDIS0009\xfa\x00"},
+			format:   dumpFormatRDB,
+			dumpPath: "dump.rdb",
+		},
+	}
+
+	for name, c := range cases {
+		dir, err := ioutil.TempDir("", "scalingo-backup-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for path, content := range c.files {
+			path = filepath.Join(dir, path)
+			os.MkdirAll(filepath.Dir(path), 0700)
+			err := ioutil.WriteFile(path, []byte(content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		format, dumpPath, err := detectDumpFormat(dir)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if format != c.format {
+			t.Fatalf("%s: expected %s, got %s", name, c.format, format)
+		}
+		if dumpPath != filepath.Join(dir, c.dumpPath) {
+			t.Fatalf("%s: expected %s, got %s", name, c.dumpPath, dumpPath)
+		}
+	}
+}
+
+func TestRestoreConfigStatements(t *testing.T) {
+	config := RestoreConfig{
+		Anonymize: []AnonymizedColumn{
+			{Table: "users", Column: "email", Value: "'user' || id || '@example.com'"},
+			{Table: "users", Column: "phone"},
+		},
+		AfterRestore: []string{"DELETE FROM sessions"},
+	}
+	expected := []string{
+		"UPDATE users SET email = 'user' || id || '@example.com';",
+		"UPDATE users SET phone = NULL;",
+		"DELETE FROM sessions;",
+	}
+	statements := config.statements()
+	if len(statements) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, statements)
+	}
+	for i := range expected {
+		if statements[i] != expected[i] {
+			t.Fatalf("expected %s, got %s", expected[i], statements[i])
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/debug"
+	stdio "github.com/Scalingo/cli/io"
+	"github.com/Scalingo/cli/signals"
+	scalingo "github.com/Scalingo/go-scalingo"
+	humanize "github.com/dustin/go-humanize"
+	errgo "gopkg.in/errgo.v1"
+)
+
+const (
+	backupSyncManifestFile = "manifest.json"
+	backupSyncLockFile     = ".backups-sync.lock"
+)
+
+// backupAddonProviders are the addon providers of the databases having backups
+var backupAddonProviders = []string{
+	"postgresql", "mysql", "mongodb", "redis", "influxdb", "elasticsearch",
+}
+
+type BackupSyncOpts struct {
+	Dir string
+	// Keep is the number of backups kept locally, 0 keeps all of them
+	Keep int
+}
+
+// BackupSyncManifest describes the backups mirrored in a directory, it is
+// written in the manifest.json file of the directory after each sync.
+type BackupSyncManifest struct {
+	App       string            `json:"app"`
+	Addon     string            `json:"addon"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Backups   []BackupSyncEntry `json:"backups"`
+}
+
+type BackupSyncEntry struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      uint64    `json:"size"`
+	File      string    `json:"file"`
+	SHA256    string    `json:"sha256"`
+}
+
+// SyncBackups mirrors the successful backups of an addon in a local directory
+func SyncBackups(app, addon string, opts BackupSyncOpts) error {
+	unlock, err := lockBackupSync(opts.Dir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer unlock()
+
+	return syncAddonBackups(app, addon, opts.Dir, opts.Keep)
+}
+
+// SyncAllBackups mirrors the backups of all the databases of all the
+// applications of the user, in a DIR/<app>/<addon> directory per addon. The
+// sync goes on when an addon fails, the error lists the addons in failure.
+func SyncAllBackups(opts BackupSyncOpts) error {
+	unlock, err := lockBackupSync(opts.Dir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer unlock()
+
+	client := config.ScalingoClient()
+	apps, err := client.AppsList()
+	if err != nil {
+		return errgo.Notef(err, "fail to list applications")
+	}
+
+	var failures []string
+	for _, app := range apps {
+		addons, err := client.AddonsList(app.Name)
+		if err != nil {
+			stdio.Errorf("%s: fail to list addons: %v\n", app.Name, err)
+			failures = append(failures, app.Name)
+			continue
+		}
+		for _, addon := range addons {
+			if !HasBackups(addon) {
+				continue
+			}
+			dir := filepath.Join(opts.Dir, app.Name, addon.ID)
+			err := syncAddonBackups(app.Name, addon.ID, dir, opts.Keep)
+			if err != nil {
+				stdio.Errorf("%s/%s: %v\n", app.Name, addon.ID, err)
+				failures = append(failures, app.Name+"/"+addon.ID)
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return errgo.Newf("the sync of %d addon(s) failed: %v", len(failures), failures)
+	}
+	return nil
+}
+
+// HasBackups returns true if the addon is a database with backups
+func HasBackups(addon *scalingo.Addon) bool {
+	providerID := addon.AddonProviderID
+	if addon.AddonProvider != nil {
+		providerID = addon.AddonProvider.ID
+	}
+	for _, provider := range backupAddonProviders {
+		if provider == providerID {
+			return true
+		}
+	}
+	return false
+}
+
+func syncAddonBackups(app, addon, dir string, keep int) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return errgo.Notef(err, "fail to create the backup directory")
+	}
+
+	manifest, err := readBackupSyncManifest(dir)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	manifest.App = app
+	manifest.Addon = addon
+
+	client := config.ScalingoClient()
+	backups, err := client.BackupList(app, addon)
+	if err != nil {
+		return errgo.Notef(err, "fail to list backups")
+	}
+
+	var done []scalingo.Backup
+	for _, backup := range backups {
+		if backup.Status == scalingo.BackupStatusDone {
+			done = append(done, backup)
+		}
+	}
+	sort.Slice(done, func(i, j int) bool {
+		return done[i].CreatedAt.After(done[j].CreatedAt)
+	})
+	if keep > 0 && len(done) > keep {
+		done = done[:keep]
+	}
+
+	stdio.Statusf("%s/%s: %d backup(s) to mirror in %s\n", app, addon, len(done), dir)
+	var failures int
+	for _, backup := range done {
+		if manifest.contains(dir, backup) {
+			debug.Println("Backup", backup.ID, "already present")
+			continue
+		}
+		entry, err := downloadSyncedBackup(app, addon, dir, backup)
+		if err != nil {
+			stdio.Errorf("%s/%s: fail to download backup %s: %v\n", app, addon, backup.ID, err)
+			failures++
+			continue
+		}
+		stdio.Infof("Backup %s of %s downloaded (%s)\n", backup.ID, backup.CreatedAt.Format(time.RFC1123), humanize.Bytes(backup.Size))
+		manifest.add(entry)
+	}
+
+	if keep > 0 {
+		manifest.prune(dir, keep)
+	}
+
+	manifest.UpdatedAt = time.Now()
+	err = writeBackupSyncManifest(dir, manifest)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	if failures > 0 {
+		return errgo.Newf("%d backup(s) failed to download", failures)
+	}
+	return nil
+}
+
+func downloadSyncedBackup(app, addon, dir string, backup scalingo.Backup) (BackupSyncEntry, error) {
+	file := fmt.Sprintf("%s_%s.tar.gz", backup.CreatedAt.UTC().Format("20060102-150405"), backup.ID)
+	path := filepath.Join(dir, file)
+	err := DownloadBackup(app, addon, backup.ID, DownloadBackupOpts{Output: path, Silent: true})
+	if err != nil {
+		return BackupSyncEntry{}, errgo.Mask(err)
+	}
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return BackupSyncEntry{}, errgo.Mask(err)
+	}
+	return BackupSyncEntry{
+		ID:        backup.ID,
+		Name:      backup.Name,
+		CreatedAt: backup.CreatedAt,
+		Size:      backup.Size,
+		File:      file,
+		SHA256:    sum,
+	}, nil
+}
+
+// contains returns true if the backup is in the manifest and its file has the
+// expected size
+func (m *BackupSyncManifest) contains(dir string, backup scalingo.Backup) bool {
+	for _, entry := range m.Backups {
+		if entry.ID != backup.ID {
+			continue
+		}
+		stat, err := os.Stat(filepath.Join(dir, entry.File))
+		return err == nil && uint64(stat.Size()) == entry.Size
+	}
+	return false
+}
+
+// add records a downloaded backup, replacing the previous entry of an
+// incomplete copy
+func (m *BackupSyncManifest) add(entry BackupSyncEntry) {
+	for i := range m.Backups {
+		if m.Backups[i].ID == entry.ID {
+			m.Backups[i] = entry
+			return
+		}
+	}
+	m.Backups = append(m.Backups, entry)
+}
+
+// prune removes the local copies of the backups older than the keep most
+// recent ones
+func (m *BackupSyncManifest) prune(dir string, keep int) {
+	sort.Slice(m.Backups, func(i, j int) bool {
+		return m.Backups[i].CreatedAt.After(m.Backups[j].CreatedAt)
+	})
+	if len(m.Backups) <= keep {
+		return
+	}
+	for _, entry := range m.Backups[keep:] {
+		err := os.Remove(filepath.Join(dir, entry.File))
+		if err != nil && !os.IsNotExist(err) {
+			stdio.Warning(fmt.Sprintf("fail to remove %s: %v", entry.File, err))
+			continue
+		}
+		debug.Println("Pruned backup", entry.ID)
+	}
+	m.Backups = m.Backups[:keep]
+}
+
+func readBackupSyncManifest(dir string) (*BackupSyncManifest, error) {
+	manifest := &BackupSyncManifest{}
+	content, err := ioutil.ReadFile(filepath.Join(dir, backupSyncManifestFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to read the manifest")
+	}
+	err = json.Unmarshal(content, manifest)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid manifest in %s", dir)
+	}
+	return manifest, nil
+}
+
+// writeBackupSyncManifest replaces the manifest atomically, a sync
+// interrupted while writing it doesn't leave a truncated file
+func writeBackupSyncManifest(dir string, manifest *BackupSyncManifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	path := filepath.Join(dir, backupSyncManifestFile)
+	err = ioutil.WriteFile(path+".tmp", content, 0600)
+	if err != nil {
+		return errgo.Notef(err, "fail to write the manifest")
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return errgo.Notef(err, "fail to write the manifest")
+	}
+	return nil
+}
+
+// lockBackupSync prevents two syncs from running in the same directory, for
+// instance when a cron job lasts longer than its period. The lock file
+// contains the PID of the sync, it is considered stale once this process is
+// gone. The lock is released by the returned function or on a quit signal.
+func lockBackupSync(dir string) (func(), error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to create the backup directory")
+	}
+	path := filepath.Join(dir, backupSyncLockFile)
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		pid, running := backupSyncLockOwner(path)
+		if running {
+			return nil, errgo.Newf("another sync is running in %s (pid %d)", dir, pid)
+		}
+		debug.Println("removing the stale lock", path, "of pid", pid)
+		os.Remove(path)
+		fd, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			return nil, errgo.Newf("another sync is running in %s", dir)
+		}
+	}
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to create the lock file")
+	}
+	fd.WriteString(strconv.Itoa(os.Getpid()))
+	fd.Close()
+
+	unregister := signals.OnQuit(func() {
+		os.Remove(path)
+	})
+	return func() {
+		unregister()
+		os.Remove(path)
+	}, nil
+}
+
+// backupSyncLockOwner returns the PID written in the lock file and whether
+// this process is still running. A lock without PID is considered held while
+// it is recent, its owner may not have written it yet.
+func backupSyncLockOwner(path string) (int, bool) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, true
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		stat, err := os.Stat(path)
+		return 0, err == nil && time.Since(stat.ModTime()) < time.Minute
+	}
+	return pid, processRunning(pid)
+}
+
+func fileSHA256(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	defer fd.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, fd)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,9 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package db
+
+// processRunning can't check the process on this system, it is considered
+// running so that the lock is never taken from a running synchronization
+func processRunning(pid int) bool {
+	return true
+}
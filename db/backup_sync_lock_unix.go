@@ -0,0 +1,12 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package db
+
+import "syscall"
+
+// processRunning checks if a process exists by sending it the null signal, a
+// process of another user can't be signaled but still exists
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,13 @@
+package db
+
+import "os"
+
+// processRunning checks if a process exists, opening it fails otherwise
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
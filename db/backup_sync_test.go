@@ -0,0 +1,71 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupSyncManifestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scalingo-backups-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := &BackupSyncManifest{}
+	now := time.Now()
+	for i, id := range []string{"old", "recent", "oldest"} {
+		entry := BackupSyncEntry{ID: id, File: id + ".tar.gz", CreatedAt: now.Add(-time.Duration(i) * time.Hour)}
+		if id == "recent" {
+			entry.CreatedAt = now.Add(time.Hour)
+		}
+		err := ioutil.WriteFile(filepath.Join(dir, entry.File), []byte(id), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest.add(entry)
+	}
+
+	manifest.prune(dir, 2)
+
+	if len(manifest.Backups) != 2 || manifest.Backups[0].ID != "recent" || manifest.Backups[1].ID != "old" {
+		t.Fatalf("expected the recent and old backups to be kept, got %v", manifest.Backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "oldest.tar.gz")); !os.IsNotExist(err) {
+		t.Fatalf("expected the oldest backup to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.tar.gz")); err != nil {
+		t.Fatalf("expected the old backup to be kept, got %v", err)
+	}
+}
+
+func TestLockBackupSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scalingo-backups-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, backupSyncLockFile)
+
+	// The lock of a process which is gone is stale
+	err = ioutil.WriteFile(path, []byte("999999999"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := lockBackupSync(dir)
+	if err != nil {
+		t.Fatal("a stale lock should be replaced, got", err)
+	}
+
+	if _, err := lockBackupSync(dir); err == nil {
+		t.Fatal("the lock of a running sync should not be taken")
+	}
+
+	unlock()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("the lock file should be removed")
+	}
+}
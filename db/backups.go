@@ -2,6 +2,7 @@ package db
 
 import (
 	"os"
+	"sort"
 	"time"
 
 	"github.com/Scalingo/cli/config"
@@ -33,6 +34,35 @@ func ListBackups(app, addon string) error {
 	t.Render()
 	return nil
 }
+
+// LatestBackup returns the most recent successful backup of the addon,
+// created before the given date if it is not zero.
+func LatestBackup(app, addon string, before time.Time) (*scalingo.Backup, error) {
+	client := config.ScalingoClient()
+	backups, err := client.BackupList(app, addon)
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to list backups")
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	for _, backup := range backups {
+		if backup.Status != scalingo.BackupStatusDone {
+			continue
+		}
+		if !before.IsZero() && !backup.CreatedAt.Before(before) {
+			continue
+		}
+		return &backup, nil
+	}
+
+	if before.IsZero() {
+		return nil, errgo.New("no successful backup found for this addon")
+	}
+	return nil, errgo.Newf("no successful backup found for this addon before %s", before.Format(time.RFC1123))
+}
+
 func formatBackupStatus(status scalingo.BackupStatus) string {
 	switch status {
 	case scalingo.BackupStatusScheduled:
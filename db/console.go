@@ -0,0 +1,260 @@
+package db
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/Scalingo/cli/apps"
+	netssh "github.com/Scalingo/cli/net/ssh"
+	"gopkg.in/errgo.v1"
+)
+
+// ConsoleKind declares how to open a console on a kind of addon. The client
+// arguments are templates rendered with a consoleTarget, the arguments
+// rendered as an empty string are dropped.
+type ConsoleKind struct {
+	// Name is the name of the database, displayed in the messages
+	Name string
+	// EnvPrefix is the prefix of the environment variables containing the URL
+	// of the addons of this kind
+	EnvPrefix string
+	// Schemes are the schemes accepted for the URL of the addon
+	Schemes []string
+	// Fetcher is the argument of dbclient-fetcher installing the client in the
+	// one-off container
+	Fetcher string
+	// Binary is the name of the client
+	Binary string
+	// Args are the arguments of the client in a one-off container, they are
+	// interpreted by a shell
+	Args []string
+	// LocalArgs and LocalEnv are the arguments and the environment of the
+	// client installed locally, run with --local. The credentials go through
+	// the environment rather than the command line when the client allows it.
+	LocalArgs []string
+	LocalEnv  []string
+	// LocalScript is written in a temporary file given as last argument to the
+	// local client, for the credentials of a client which can't read them from
+	// the environment
+	LocalScript string
+	// DisplayCmd is the command displayed in the list of running containers
+	DisplayCmd string
+	// StdinCopyFunc replaces the copy of the input to the one-off container
+	StdinCopyFunc func(io.Writer, io.Reader) (int64, error)
+	// Run replaces the client when the console is implemented by the CLI, it
+	// is run with the local end of a tunnel to the database
+	Run func(dbURL *url.URL, host, port string) error
+}
+
+var (
+	PgSQLConsole = ConsoleKind{
+		Name:       "PostgreSQL",
+		EnvPrefix:  "SCALINGO_POSTGRESQL",
+		Schemes:    []string{"postgres://", "postgis://"},
+		Fetcher:    "pgsql",
+		Binary:     "psql",
+		Args:       []string{"'{{.URL}}'"},
+		LocalArgs:  []string{"{{.URLWithoutPassword}}"},
+		LocalEnv:   []string{"PGPASSWORD={{.Password}}"},
+		DisplayCmd: "pgsql-console {{.User}}",
+	}
+
+	MySQLConsole = ConsoleKind{
+		Name:       "MySQL",
+		EnvPrefix:  "SCALINGO_MYSQL",
+		Schemes:    []string{"mysql://", "mysql2://"}, // "mysql2://" for ruby driver 'mysql2'
+		Fetcher:    "mysql",
+		Binary:     "mysql",
+		Args:       []string{"-h", "{{.Host}}", "-P", "{{.Port}}", "--password={{.Password}}", "-u", "{{.User}}", "{{.User}}"},
+		LocalArgs:  []string{"-h", "{{.Host}}", "-P", "{{.Port}}", "--protocol=TCP", "-u", "{{.User}}", "{{.User}}"},
+		LocalEnv:   []string{"MYSQL_PWD={{.Password}}"},
+		DisplayCmd: "mysql-console {{.User}}",
+	}
+
+	MongoConsole = ConsoleKind{
+		Name:        "MongoDB",
+		EnvPrefix:   "SCALINGO_MONGO",
+		Schemes:     []string{"mongodb://"},
+		Fetcher:     "mongo",
+		Binary:      "mongo",
+		Args:        []string{"{{if .TLS}}--ssl{{end}}", "{{if .TLS}}--sslAllowInvalidCertificates{{end}}", "'{{.URL}}'"},
+		LocalArgs:   []string{"{{if .TLS}}--ssl{{end}}", "{{if .TLS}}--sslAllowInvalidCertificates{{end}}", "--host", "{{.Host}}", "--port", "{{.Port}}", "--shell", "{{.Database}}"},
+		LocalScript: `db.auth("{{js .User}}", "{{js .Password}}");`,
+		DisplayCmd:  "mongo-console",
+	}
+
+	RedisConsole = ConsoleKind{
+		Name:          "Redis",
+		EnvPrefix:     "SCALINGO_REDIS",
+		Schemes:       []string{"redis://"},
+		Fetcher:       "redis",
+		Binary:        "redis-cli",
+		Args:          []string{"-h", "{{.Host}}", "-p", "{{.Port}}", "-a", "{{.Password}}"},
+		LocalArgs:     []string{"-h", "{{.Host}}", "-p", "{{.Port}}"},
+		LocalEnv:      []string{"REDISCLI_AUTH={{.Password}}"},
+		DisplayCmd:    "redis-console {{.ShortHost}}",
+		StdinCopyFunc: redisStdinCopy,
+	}
+
+	InfluxDBConsole = ConsoleKind{
+		Name:       "InfluxDB",
+		EnvPrefix:  "SCALINGO_INFLUX",
+		Schemes:    []string{"http://", "https://"},
+		Fetcher:    "influxdb",
+		Binary:     "influx",
+		Args:       []string{"{{if .TLS}}-ssl{{end}}", "{{if .TLS}}-unsafeSsl{{end}}", "-host", "{{.Host}}", "-port", "{{.Port}}", "-username", "{{.User}}", "-password", "{{.Password}}", "-database", "{{.Database}}"},
+		LocalArgs:  []string{"{{if .TLS}}-ssl{{end}}", "{{if .TLS}}-unsafeSsl{{end}}", "-host", "{{.Host}}", "-port", "{{.Port}}", "-database", "{{.Database}}"},
+		LocalEnv:   []string{"INFLUX_USERNAME={{.User}}", "INFLUX_PASSWORD={{.Password}}"},
+		DisplayCmd: "influxdb-console {{.ShortHost}}",
+	}
+
+	ElasticsearchConsole = ConsoleKind{
+		Name:      "Elasticsearch",
+		EnvPrefix: "SCALINGO_ELASTICSEARCH",
+		Schemes:   []string{"http://", "https://"},
+		Run:       elasticsearchREPL,
+	}
+)
+
+type ConsoleOpts struct {
+	App   string
+	Size  string
+	Local bool
+	Addon AddonSelector
+	// Identity is the SSH key used to build the tunnel, a path or "ssh-agent"
+	Identity string
+	// HostKey configures the verification of the SSH server, when the console
+	// goes through a tunnel
+	HostKey netssh.HostKeyOpts
+}
+
+// consoleTarget is given to the templates of the console arguments
+type consoleTarget struct {
+	URL                string
+	URLWithoutPassword string
+	Host               string
+	// ShortHost is the first label of the host name
+	ShortHost string
+	Port      string
+	User      string
+	Password  string
+	Database  string
+	TLS       bool
+}
+
+func newConsoleTarget(u *url.URL, host, port string) consoleTarget {
+	target := consoleTarget{
+		URL:       u.String(),
+		Host:      host,
+		ShortHost: strings.Split(host, ".")[0],
+		Port:      port,
+		Database:  strings.TrimPrefix(u.Path, "/"),
+		TLS:       u.Scheme == "https" || u.Query().Get("ssl") == "true" || u.Query().Get("tls") == "true",
+	}
+	withoutPassword := *u
+	if u.User != nil {
+		target.User = u.User.Username()
+		target.Password, _ = u.User.Password()
+		withoutPassword.User = url.User(target.User)
+	}
+	target.URLWithoutPassword = withoutPassword.String()
+	return target
+}
+
+// Console opens an interactive console on an addon of the given kind, in a
+// one-off container or locally through a tunnel.
+func Console(kind ConsoleKind, opts ConsoleOpts) error {
+	addonURL, _, _, err := dbURL(opts.App, kind.EnvPrefix, kind.Schemes, opts.Addon)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	host, port, err := net.SplitHostPort(addonURL.Host)
+	if err != nil {
+		return errgo.Newf("%v has an invalid host", addonURL)
+	}
+
+	if kind.Run != nil {
+		return runLocalTunnel(addonURL, opts, func(host, port string) error {
+			return kind.Run(addonURL, host, port)
+		})
+	}
+
+	if opts.Local {
+		return runLocalConsole(addonURL, opts, kind.Binary, func(host, port string) ([]string, []string, string) {
+			target := newConsoleTarget(localURL(addonURL, host, port), host, port)
+			script := strings.Join(renderConsoleArgs([]string{kind.LocalScript}, target), "")
+			return renderConsoleArgs(kind.LocalArgs, target), renderConsoleArgs(kind.LocalEnv, target), script
+		})
+	}
+
+	target := newConsoleTarget(addonURL, host, port)
+	cmd := []string{"dbclient-fetcher", kind.Fetcher, "&&", kind.Binary}
+	runOpts := apps.RunOpts{
+		DisplayCmd:    strings.Join(renderConsoleArgs([]string{kind.DisplayCmd}, target), ""),
+		App:           opts.App,
+		Cmd:           append(cmd, renderConsoleArgs(kind.Args, target)...),
+		Size:          opts.Size,
+		StdinCopyFunc: kind.StdinCopyFunc,
+	}
+
+	err = apps.Run(runOpts)
+	if err != nil {
+		return errgo.Newf("Fail to run %s console: %v", kind.Name, err)
+	}
+
+	return nil
+}
+
+// renderConsoleArgs renders the argument templates, dropping the empty ones.
+// The templates are declared in this package, an invalid one is a bug.
+func renderConsoleArgs(args []string, target consoleTarget) []string {
+	var res []string
+	for _, arg := range args {
+		tmpl := template.Must(template.New("arg").Parse(arg))
+		var buffer bytes.Buffer
+		err := tmpl.Execute(&buffer, target)
+		if err != nil {
+			panic(err)
+		}
+		if buffer.Len() > 0 {
+			res = append(res, buffer.String())
+		}
+	}
+	return res
+}
+
+func redisStdinCopy(dst io.Writer, src io.Reader) (written int64, err error) {
+	buf := make([]byte, 2*1024)
+	for {
+		nr, er := src.Read(buf)
+		if nr > 0 {
+			toWrite := bytes.Replace(buf[0:nr], []byte{'\n'}, []byte{'\r', '\n'}, -1)
+			nr = len(toWrite)
+			nw, ew := dst.Write(toWrite)
+			if nw > 0 {
+				written += int64(nw)
+			}
+			if ew != nil {
+				err = ew
+				break
+			}
+			if nr != nw {
+				err = io.ErrShortWrite
+				break
+			}
+		}
+		if er == io.EOF {
+			break
+		}
+		if er != nil {
+			err = er
+			break
+		}
+	}
+	return written, err
+}
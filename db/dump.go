@@ -0,0 +1,569 @@
+package db
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	stdio "io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/cli/apps"
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/go-scalingo"
+	"github.com/cheggaaa/pb"
+	"gopkg.in/errgo.v1"
+)
+
+// The dump goes through the terminal of the one-off container, it is
+// compressed and encoded in base64 so that it is not altered by the terminal.
+// Markers delimit the dump among the other outputs of the container.
+const (
+	dumpBeginMarker     = "=== scalingo db-dump begin ==="
+	dumpEndMarker       = "=== scalingo db-dump end"
+	restoreReadyMarker  = "=== scalingo db-restore ready ==="
+	dumpBase64LineWidth = 76
+)
+
+// dumpTool describes how a kind of database is dumped and restored with its
+// native tools in a one-off container.
+type dumpTool struct {
+	name      string
+	fetcher   string
+	schemes   []string
+	extension string
+	// dump is the shell command writing the dump of the database on stdout
+	dump func(u *url.URL) string
+	// restore is the shell command restoring the dump read on stdin
+	restore func(u *url.URL) string
+}
+
+var dumpTools = []dumpTool{
+	{
+		name: "PostgreSQL", fetcher: "pgsql", schemes: []string{"postgres://", "postgis://"}, extension: "sql",
+		dump: func(u *url.URL) string {
+			return "pg_dump --clean --if-exists --no-owner --no-privileges " + shellQuote(u.String())
+		},
+		restore: func(u *url.URL) string {
+			return "psql --quiet -v ON_ERROR_STOP=1 " + shellQuote(u.String())
+		},
+	}, {
+		name: "MySQL", fetcher: "mysql", schemes: []string{"mysql://", "mysql2://"}, extension: "sql",
+		dump: func(u *url.URL) string {
+			return "mysqldump --single-transaction --routines --triggers " + mysqlArgs(u)
+		},
+		restore: func(u *url.URL) string {
+			return "mysql " + mysqlArgs(u)
+		},
+	}, {
+		name: "MongoDB", fetcher: "mongo", schemes: []string{"mongodb://"}, extension: "archive",
+		dump: func(u *url.URL) string {
+			return "mongodump --archive " + mongoArgs(u)
+		},
+		restore: func(u *url.URL) string {
+			return "mongorestore --archive --drop " + mongoArgs(u)
+		},
+	}, {
+		// An RDB file is only loaded by a Redis server when it starts, the dump
+		// is a list of RESTORE commands sent back with redis-cli --pipe.
+		name: "Redis", fetcher: "redis", schemes: []string{"redis://"}, extension: "resp",
+		dump: func(u *url.URL) string {
+			return fmt.Sprintf(
+				`cursor=0; while :; do redis-cli %s --raw EVAL %s 0 "$cursor" >/tmp/dump.batch || exit 1; `+
+					`cursor=$(head -n 1 /tmp/dump.batch); case "$cursor" in ''|*[!0-9]*) cat /tmp/dump.batch >&2; exit 1;; esac; `+
+					`tail -n +2 /tmp/dump.batch | head -c -1; [ "$cursor" = 0 ] && break; done`,
+				redisArgs(u), shellQuote(redisDumpScript),
+			)
+		},
+		restore: func(u *url.URL) string {
+			return "redis-cli " + redisArgs(u) + " --pipe"
+		},
+	},
+}
+
+// redisDumpScript scans a batch of keys and returns the next cursor on the
+// first line, followed by the RESTORE commands of the keys in the Redis
+// protocol. The values serialized by DUMP are binary, the script output is
+// written as is with redis-cli --raw.
+const redisDumpScript = `
+local res = redis.call('SCAN', ARGV[1], 'COUNT', 1000)
+local out = {res[1], '\n'}
+for _, key in ipairs(res[2]) do
+  local value = redis.call('DUMP', key)
+  if value then
+    local ttl = redis.call('PTTL', key)
+    if ttl < 0 then ttl = 0 end
+    ttl = tostring(ttl)
+    out[#out+1] = '*5\r\n$7\r\nRESTORE\r\n$' .. #key .. '\r\n' .. key .. '\r\n$' .. #ttl .. '\r\n' .. ttl ..
+      '\r\n$' .. #value .. '\r\n' .. value .. '\r\n$7\r\nREPLACE\r\n'
+  end
+end
+return table.concat(out)
+`
+
+type DumpOpts struct {
+	App    string
+	Addon  AddonSelector
+	Output string
+	Size   string
+}
+
+type RestoreOpts struct {
+	App   string
+	Addon AddonSelector
+	Input string
+	Size  string
+}
+
+func Dump(opts DumpOpts) error {
+	dbURL, tool, err := dumpTarget(opts.App, opts.Addon)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	output := opts.Output
+	if output == "" {
+		output = fmt.Sprintf("%s-%s-%s.%s.gz", opts.App, tool.fetcher, time.Now().Format("20060102-150405"), tool.extension)
+	}
+	receiver, err := newDumpReceiver(output)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Dumping the %s database %s into %s\n", tool.name, dbURL.Hostname(), output)
+	script := fmt.Sprintf(
+		"echo %s; { ( %s ) 2>/tmp/dump.err; echo $? >/tmp/dump.status; } | gzip -c | base64; echo %s $(cat /tmp/dump.status); cat /tmp/dump.err; exit $(cat /tmp/dump.status)",
+		shellQuote(dumpBeginMarker), tool.dump(dbURL), shellQuote(dumpEndMarker),
+	)
+	err = apps.Run(apps.RunOpts{
+		App:            opts.App,
+		DisplayCmd:     "db-dump " + strings.Split(dbURL.Hostname(), ".")[0],
+		Cmd:            []string{"dbclient-fetcher", tool.fetcher, "&&", "stty", "-echo", "&&", script},
+		Size:           opts.Size,
+		StdinCopyFunc:  receiver.waitEnd,
+		StdoutCopyFunc: receiver.receive,
+	})
+	if err != nil {
+		receiver.abort()
+		return errgo.Notef(err, "fail to dump the %s database", tool.name)
+	}
+	return nil
+}
+
+func Restore(opts RestoreOpts) error {
+	dbURL, tool, err := dumpTarget(opts.App, opts.Addon)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	file, err := os.Open(opts.Input)
+	if err != nil {
+		return errgo.Notef(err, "fail to open the dump")
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	fmt.Printf(
+		"/!\\ You're going to restore %s into the %s database %s of %s, its current data will be overwritten.\nTo confirm type the name of the application: ",
+		opts.Input, tool.name, dbURL.Hostname(), opts.App,
+	)
+	validationName, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	validationName = strings.TrimSpace(validationName)
+	if validationName != opts.App {
+		return errgo.Newf("'%s' is not '%s', aborting…", validationName, opts.App)
+	}
+
+	sender := &dumpSender{
+		file:       file,
+		size:       stat.Size(),
+		compressed: strings.HasSuffix(opts.Input, ".gz"),
+		ready:      make(chan struct{}),
+	}
+	script := fmt.Sprintf(
+		"echo %s && base64 -d | gunzip -c | %s",
+		shellQuote(restoreReadyMarker), tool.restore(dbURL),
+	)
+	err = apps.Run(apps.RunOpts{
+		App:            opts.App,
+		DisplayCmd:     "db-restore " + strings.Split(dbURL.Hostname(), ".")[0],
+		Cmd:            []string{"dbclient-fetcher", tool.fetcher, "&&", "stty", "-echo", "&&", script},
+		Size:           opts.Size,
+		StdinCopyFunc:  sender.send,
+		StdoutCopyFunc: sender.receive,
+	})
+	if err != nil {
+		return errgo.Notef(err, "fail to restore the %s database", tool.name)
+	}
+	return nil
+}
+
+// dumpTarget returns the URL of the selected database addon and the tools to
+// dump it.
+func dumpTarget(app string, selector AddonSelector) (*url.URL, dumpTool, error) {
+	c := config.ScalingoClient()
+	environ, err := c.VariablesListWithoutAlias(app)
+	if err != nil {
+		return nil, dumpTool{}, errgo.Mask(err)
+	}
+
+	var value string
+	if selector.EnvVar != "" {
+		variable, ok := environ.Contains(selector.EnvVar)
+		if !ok {
+			return nil, dumpTool{}, errgo.Newf("no such environment variable: %s", selector.EnvVar)
+		}
+		value = variable.Value
+	} else {
+		var candidates scalingo.Variables
+		for _, name := range addonEnvVars(environ) {
+			variable, _ := environ.Contains(name)
+			if _, ok := findDumpTool(variable.Value); ok {
+				candidates = append(candidates, variable)
+			}
+		}
+		value, err = selectAddonURL(app, "database", candidates, selector)
+		if err != nil {
+			return nil, dumpTool{}, errgo.Mask(err)
+		}
+	}
+
+	tool, ok := findDumpTool(value)
+	if !ok {
+		return nil, dumpTool{}, errgo.Newf("%s is not a PostgreSQL, MySQL, MongoDB or Redis database", urlHost(value))
+	}
+	dbURL, err := url.Parse(value)
+	if err != nil {
+		return nil, dumpTool{}, errgo.Newf("%v is not a valid URL", urlHost(value))
+	}
+	return dbURL, tool, nil
+}
+
+func findDumpTool(value string) (dumpTool, bool) {
+	for _, tool := range dumpTools {
+		if hasScheme(value, tool.schemes) {
+			return tool, true
+		}
+	}
+	return dumpTool{}, false
+}
+
+// dumpReceiver decodes the dump sent by the container and writes it in a
+// temporary file, renamed once the dump has succeeded. The dump is kept
+// compressed if the output file ends with .gz.
+type dumpReceiver struct {
+	output   string
+	partPath string
+	file     *os.File
+	writer   stdio.WriteCloser
+	written  chan error
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func newDumpReceiver(output string) (*dumpReceiver, error) {
+	partPath := output + ".part"
+	file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to create the dump file")
+	}
+
+	r := &dumpReceiver{
+		output:   output,
+		partPath: partPath,
+		file:     file,
+		writer:   file,
+		written:  make(chan error, 1),
+		done:     make(chan struct{}),
+	}
+	if strings.HasSuffix(output, ".gz") {
+		r.written <- nil
+		return r, nil
+	}
+
+	// The dump is decompressed on the fly
+	pipeReader, pipeWriter := stdio.Pipe()
+	r.writer = pipeWriter
+	go func() {
+		gzipReader, err := gzip.NewReader(pipeReader)
+		if err == nil {
+			_, err = stdio.Copy(file, gzipReader)
+		}
+		pipeReader.CloseWithError(err)
+		r.written <- err
+	}()
+	return r, nil
+}
+
+// waitEnd is the stdin copy function of the dump, nothing is sent to the
+// container.
+func (r *dumpReceiver) waitEnd(_ stdio.Writer, _ stdio.Reader) (int64, error) {
+	<-r.done
+	return 0, nil
+}
+
+// receive is the stdout copy function of the dump: the outputs of the
+// container are displayed on stderr, the dump itself is decoded.
+func (r *dumpReceiver) receive(_ stdio.Writer, socket stdio.Reader) (int64, error) {
+	defer r.doneOnce.Do(func() { close(r.done) })
+
+	var (
+		read    int64
+		bar     *pb.ProgressBar
+		dumping bool
+		ended   bool
+		reader  = bufio.NewReader(socket)
+	)
+	for {
+		line, err := reader.ReadString('\n')
+		read += int64(len(line))
+		trimmed := strings.TrimRight(line, "\r\n")
+
+		switch {
+		case !dumping && !ended && trimmed == dumpBeginMarker:
+			dumping = true
+			bar = pb.New64(0).SetUnits(pb.U_BYTES)
+			bar.Output = os.Stderr
+			bar.Start()
+		case dumping && strings.HasPrefix(trimmed, dumpEndMarker):
+			dumping, ended = false, true
+			status := strings.TrimSpace(strings.TrimPrefix(trimmed, dumpEndMarker))
+			bar.Finish()
+			finishErr := r.finish(status == "0")
+			if finishErr != nil {
+				return read, finishErr
+			}
+		case dumping:
+			decoded, decodeErr := base64.StdEncoding.DecodeString(trimmed)
+			if decodeErr != nil {
+				r.abort()
+				return read, errgo.Notef(decodeErr, "invalid data received from the container")
+			}
+			bar.Add(len(decoded))
+			_, writeErr := r.writer.Write(decoded)
+			if writeErr != nil {
+				r.abort()
+				return read, errgo.Notef(writeErr, "fail to write the dump")
+			}
+		default:
+			fmt.Fprint(os.Stderr, line)
+		}
+
+		if err != nil {
+			if dumping {
+				r.abort()
+				return read, errgo.New("the connection to the container has been lost before the end of the dump")
+			}
+			if !ended {
+				// The dump has not started, the exit code of the container tells why
+				r.abort()
+			}
+			if err == stdio.EOF {
+				return read, nil
+			}
+			return read, err
+		}
+	}
+}
+
+// finish closes the dump file, it is moved to its final location if the
+// dump command succeeded.
+func (r *dumpReceiver) finish(success bool) error {
+	r.writer.Close()
+	err := <-r.written
+	r.file.Close()
+	if !success {
+		os.Remove(r.partPath)
+		fmt.Fprintln(os.Stderr, "The dump has failed:")
+		return nil
+	}
+	if err != nil {
+		os.Remove(r.partPath)
+		return errgo.Notef(err, "fail to decompress the dump")
+	}
+	err = os.Rename(r.partPath, r.output)
+	if err != nil {
+		return errgo.Notef(err, "fail to move the dump to %s", r.output)
+	}
+	fmt.Fprintf(os.Stderr, "===> %s\n", r.output)
+	return nil
+}
+
+func (r *dumpReceiver) abort() {
+	r.writer.Close()
+	r.file.Close()
+	os.Remove(r.partPath)
+}
+
+// dumpSender sends the compressed dump, encoded in base64, to the container
+// once it is ready to restore it.
+type dumpSender struct {
+	file       *os.File
+	size       int64
+	compressed bool
+	ready      chan struct{}
+	readyOnce  sync.Once
+	// started is set when the container is ready, the ready channel is also
+	// closed if the container stops before.
+	started bool
+}
+
+// send is the stdin copy function of the restore, the standard input of the
+// CLI is ignored.
+func (s *dumpSender) send(socket stdio.Writer, _ stdio.Reader) (int64, error) {
+	<-s.ready
+	if !s.started {
+		return 0, nil
+	}
+
+	bar := pb.New64(s.size).SetUnits(pb.U_BYTES)
+	bar.Output = os.Stderr
+	bar.Start()
+	defer bar.Finish()
+
+	lines := &lineWrapper{writer: socket, width: dumpBase64LineWidth}
+	encoder := base64.NewEncoder(base64.StdEncoding, lines)
+	var dst stdio.WriteCloser = encoder
+	if !s.compressed {
+		dst = &gzipEncoder{Writer: gzip.NewWriter(encoder), encoder: encoder}
+	}
+
+	_, err := stdio.Copy(dst, bar.NewProxyReader(s.file))
+	if err != nil {
+		return 0, errgo.Notef(err, "fail to send the dump")
+	}
+	err = dst.Close()
+	if err != nil {
+		return 0, errgo.Mask(err)
+	}
+	// The end of input is only understood at the beginning of a line
+	_, err = lines.flush()
+	return s.size, err
+}
+
+// receive is the stdout copy function of the restore, the outputs of the
+// container are displayed and the dump is sent once the marker is received.
+func (s *dumpSender) receive(stdout stdio.Writer, socket stdio.Reader) (int64, error) {
+	defer s.readyOnce.Do(func() { close(s.ready) })
+
+	var (
+		read   int64
+		reader = bufio.NewReader(socket)
+	)
+	for {
+		line, err := reader.ReadString('\n')
+		read += int64(len(line))
+		if strings.TrimRight(line, "\r\n") == restoreReadyMarker {
+			s.readyOnce.Do(func() {
+				s.started = true
+				close(s.ready)
+			})
+		} else {
+			fmt.Fprint(stdout, line)
+		}
+		if err == stdio.EOF {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+}
+
+// gzipEncoder closes the base64 encoder after the gzip stream
+type gzipEncoder struct {
+	*gzip.Writer
+	encoder stdio.WriteCloser
+}
+
+func (e *gzipEncoder) Close() error {
+	err := e.Writer.Close()
+	if err != nil {
+		return err
+	}
+	return e.encoder.Close()
+}
+
+// lineWrapper splits what is written in lines of the given width, the line
+// discipline of the terminal limits the length of the lines.
+type lineWrapper struct {
+	writer stdio.Writer
+	width  int
+	column int
+}
+
+func (w *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := w.width - w.column
+		if n > len(p) {
+			n = len(p)
+		}
+		_, err := w.writer.Write(p[:n])
+		if err != nil {
+			return written, err
+		}
+		written += n
+		w.column += n
+		p = p[n:]
+		if w.column == w.width {
+			if _, err := w.writer.Write([]byte{'\n'}); err != nil {
+				return written, err
+			}
+			w.column = 0
+		}
+	}
+	return written, nil
+}
+
+// flush terminates the current line
+func (w *lineWrapper) flush() (int, error) {
+	if w.column == 0 {
+		return 0, nil
+	}
+	w.column = 0
+	return w.writer.Write([]byte{'\n'})
+}
+
+func mysqlArgs(u *url.URL) string {
+	password, _ := u.User.Password()
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host, port = u.Host, "3306"
+	}
+	return fmt.Sprintf(
+		"-h %s -P %s -u %s --password=%s %s",
+		shellQuote(host), port, shellQuote(u.User.Username()), shellQuote(password), shellQuote(strings.TrimPrefix(u.Path, "/")),
+	)
+}
+
+func mongoArgs(u *url.URL) string {
+	args := "--uri=" + shellQuote(u.String())
+	if u.Query().Get("ssl") == "true" {
+		args += " --ssl --sslAllowInvalidCertificates"
+	}
+	return args
+}
+
+func redisArgs(u *url.URL) string {
+	password, _ := u.User.Password()
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host, port = u.Host, "6379"
+	}
+	return fmt.Sprintf("-h %s -p %s -a %s", shellQuote(host), port, shellQuote(password))
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
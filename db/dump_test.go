@@ -0,0 +1,100 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumpReceiverReceive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "db-dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dump := strings.Repeat("INSERT INTO t VALUES (1);\n", 100)
+	compressed := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(compressed)
+	gzipWriter.Write([]byte(dump))
+	gzipWriter.Close()
+
+	// The output of the container, as wrapped by base64 and the terminal
+	encoded := new(bytes.Buffer)
+	lines := &lineWrapper{writer: encoded, width: dumpBase64LineWidth}
+	encoder := base64.NewEncoder(base64.StdEncoding, lines)
+	encoder.Write(compressed.Bytes())
+	encoder.Close()
+	lines.flush()
+	output := "fetching client\r\n" + dumpBeginMarker + "\r\n" +
+		strings.Replace(encoded.String(), "\n", "\r\n", -1) +
+		dumpEndMarker + " 0\r\n"
+
+	output1 := filepath.Join(dir, "dump.sql")
+	receiver, err := newDumpReceiver(output1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = receiver.receive(nil, strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(output1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != dump {
+		t.Fatalf("unexpected dump content: %q", content)
+	}
+
+	output2 := filepath.Join(dir, "dump.sql.gz")
+	receiver, err = newDumpReceiver(output2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = receiver.receive(nil, strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = ioutil.ReadFile(output2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, compressed.Bytes()) {
+		t.Fatal("the compressed dump should be kept as is")
+	}
+
+	// A failed dump leaves no file
+	output3 := filepath.Join(dir, "failed.sql")
+	receiver, err = newDumpReceiver(output3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver.receive(nil, strings.NewReader(dumpBeginMarker+"\r\n"+dumpEndMarker+" 1\r\nerror\r\n"))
+	if _, err := os.Stat(output3); !os.IsNotExist(err) {
+		t.Fatal("no dump should be written when the dump fails")
+	}
+	if _, err := os.Stat(output3 + ".part"); !os.IsNotExist(err) {
+		t.Fatal("the temporary file should be removed")
+	}
+}
+
+func TestFindDumpTool(t *testing.T) {
+	for _, value := range []string{"postgres://u:p@host:5432/db", "mysql://u:p@host:3306/db", "mongodb://u:p@host:27017/db", "redis://:p@host:6379"} {
+		tool, ok := findDumpTool(value)
+		if !ok {
+			t.Fatal("no dump tool found for", value)
+		}
+		if tool.restore == nil {
+			t.Fatal(value, "should be restorable")
+		}
+	}
+	if _, ok := findDumpTool("amqp://u:p@host:5672"); ok {
+		t.Fatal("RabbitMQ can't be dumped")
+	}
+}
@@ -0,0 +1,351 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/debug"
+	stdio "github.com/Scalingo/cli/io"
+	"github.com/Scalingo/cli/signals"
+	"gopkg.in/errgo.v1"
+)
+
+const (
+	elasticsearchHistoryFile = "elasticsearch_history"
+	elasticsearchHistorySize = 1000
+)
+
+const elasticsearchConsoleHelp = `Requests are written as 'METHOD /path [body]', the method defaults to GET:
+    GET /_cat/indices?v
+    /_cluster/health
+    POST /myindex/_search {"query": {"match": {"title": "scalingo"}}}
+The body can span several lines until its braces are balanced.
+
+Other commands:
+    history     List the previous requests
+    !!          Run the previous request again
+    !N          Run the request N of the history again
+    help        Display this help
+    exit        Quit the console (or Ctrl-D)`
+
+type elasticsearchRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+func (r elasticsearchRequest) String() string {
+	if r.Body == "" {
+		return r.Method + " " + r.Path
+	}
+	return r.Method + " " + r.Path + " " + r.Body
+}
+
+type elasticsearchConsole struct {
+	baseURL  *url.URL
+	client   *http.Client
+	input    *bufio.Reader
+	history  []string
+	histPath string
+
+	// cancel cancels the running request, it's nil between requests
+	cancelM *sync.Mutex
+	cancel  context.CancelFunc
+}
+
+// elasticsearchREPL is an HTTP console to the Elasticsearch API, the requests
+// are sent through the tunnel whose local end is host:port.
+func elasticsearchREPL(dbURL *url.URL, host, port string) error {
+	baseURL := localURL(dbURL, host, port)
+	console := &elasticsearchConsole{
+		baseURL: baseURL,
+		client: &http.Client{
+			Transport: &http.Transport{
+				// The certificate is the one of the addon, not of the local end of the tunnel
+				TLSClientConfig: &tls.Config{ServerName: dbURL.Hostname()},
+			},
+		},
+		input:    bufio.NewReader(os.Stdin),
+		histPath: filepath.Join(config.C.ConfigDir, elasticsearchHistoryFile),
+		cancelM:  &sync.Mutex{},
+	}
+	console.loadHistory()
+
+	// Ctrl-C cancels the running request instead of quitting
+	signals.CatchQuitSignals = false
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			if !console.cancelRequest() {
+				fmt.Println("\n(use 'exit' or Ctrl-D to quit)")
+			}
+		}
+	}()
+
+	fmt.Printf("Connected to Elasticsearch %s, type 'help' for help\n", dbURL.Host)
+	for {
+		line, err := console.readRequest()
+		if err == io.EOF {
+			fmt.Println()
+			return nil
+		}
+		if err != nil {
+			return errgo.Mask(err)
+		}
+
+		switch {
+		case line == "":
+			continue
+		case line == "exit" || line == "quit":
+			return nil
+		case line == "help":
+			fmt.Println(elasticsearchConsoleHelp)
+			continue
+		case line == "history":
+			for i, entry := range console.history {
+				fmt.Printf("%5d  %s\n", i+1, entry)
+			}
+			continue
+		case strings.HasPrefix(line, "!"):
+			line, err = console.historyEntry(line)
+			if err != nil {
+				stdio.Error(err)
+				continue
+			}
+			fmt.Println(line)
+		}
+
+		req, err := parseElasticsearchRequest(line)
+		if err != nil {
+			stdio.Error(err)
+			continue
+		}
+		console.addHistory(req.String())
+
+		err = console.do(req)
+		if err != nil {
+			stdio.Error(err)
+		}
+	}
+}
+
+// readRequest reads a line, and the following ones while the braces of the
+// body are not balanced
+func (c *elasticsearchConsole) readRequest() (string, error) {
+	fmt.Print("elasticsearch> ")
+	line, err := c.input.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	request := strings.TrimSpace(line)
+	for !balancedBraces(request) {
+		fmt.Print("           ... ")
+		line, err := c.input.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		request += "\n" + strings.TrimRight(line, "\r\n")
+	}
+	return request, nil
+}
+
+func (c *elasticsearchConsole) do(request elasticsearchRequest) error {
+	u, err := c.baseURL.Parse(request.Path)
+	if err != nil {
+		return errgo.Newf("invalid path %s", request.Path)
+	}
+	u.User = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.cancelM.Lock()
+	c.cancel = cancel
+	c.cancelM.Unlock()
+	defer func() {
+		c.cancelM.Lock()
+		c.cancel = nil
+		c.cancelM.Unlock()
+	}()
+
+	var body io.Reader
+	if request.Body != "" {
+		body = strings.NewReader(request.Body)
+	}
+	req, err := http.NewRequest(request.Method, u.String(), body)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	req = req.WithContext(ctx)
+	if request.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.baseURL.User != nil {
+		password, _ := c.baseURL.User.Password()
+		req.SetBasicAuth(c.baseURL.User.Username(), password)
+	}
+
+	debug.Println("Elasticsearch request", request.Method, u)
+	res, err := c.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return errgo.New("request canceled")
+		}
+		return errgo.Notef(err, "fail to send the request")
+	}
+	defer res.Body.Close()
+
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errgo.Notef(err, "fail to read the response")
+	}
+	if res.StatusCode >= 300 {
+		fmt.Println(stdio.BoldRed(res.Status))
+	}
+	fmt.Println(formatElasticsearchResponse(content))
+	return nil
+}
+
+// cancelRequest cancels the running request, if any
+func (c *elasticsearchConsole) cancelRequest() bool {
+	c.cancelM.Lock()
+	defer c.cancelM.Unlock()
+	if c.cancel == nil {
+		return false
+	}
+	c.cancel()
+	return true
+}
+
+func (c *elasticsearchConsole) historyEntry(command string) (string, error) {
+	if len(c.history) == 0 {
+		return "", errgo.New("the history is empty")
+	}
+	if command == "!!" {
+		return c.history[len(c.history)-1], nil
+	}
+	n, err := strconv.Atoi(command[1:])
+	if err != nil || n < 1 || n > len(c.history) {
+		return "", errgo.Newf("no request %s in the history", command[1:])
+	}
+	return c.history[n-1], nil
+}
+
+func (c *elasticsearchConsole) loadHistory() {
+	content, err := ioutil.ReadFile(c.histPath)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			c.history = append(c.history, line)
+		}
+	}
+}
+
+// addHistory records a request, in the history file as well. The requests
+// are stored on a single line, their bodies are compacted.
+func (c *elasticsearchConsole) addHistory(request string) {
+	request = strings.Replace(request, "\n", " ", -1)
+	if len(c.history) > 0 && c.history[len(c.history)-1] == request {
+		return
+	}
+	c.history = append(c.history, request)
+	if len(c.history) > elasticsearchHistorySize {
+		c.history = c.history[len(c.history)-elasticsearchHistorySize:]
+	}
+	err := ioutil.WriteFile(c.histPath, []byte(strings.Join(c.history, "\n")+"\n"), 0600)
+	if err != nil {
+		debug.Println("Fail to write the Elasticsearch console history", err)
+	}
+}
+
+func parseElasticsearchRequest(line string) (elasticsearchRequest, error) {
+	var req elasticsearchRequest
+	line = strings.TrimSpace(line)
+	fields := strings.SplitN(line, " ", 2)
+	if strings.HasPrefix(line, "/") {
+		fields = []string{"GET", line}
+	}
+
+	req.Method = strings.ToUpper(fields[0])
+	switch req.Method {
+	case "GET", "POST", "PUT", "DELETE", "HEAD", "PATCH":
+	default:
+		return req, errgo.Newf("invalid request '%s', type 'help' for help", line)
+	}
+	if len(fields) < 2 {
+		return req, errgo.Newf("missing path in the request, type 'help' for help")
+	}
+
+	rest := strings.TrimSpace(fields[1])
+	i := strings.IndexAny(rest, " \n{")
+	if i == -1 {
+		req.Path = rest
+	} else {
+		req.Path = rest[:i]
+		req.Body = strings.TrimSpace(rest[i:])
+	}
+	if !strings.HasPrefix(req.Path, "/") {
+		req.Path = "/" + req.Path
+	}
+
+	if req.Body != "" {
+		var compact bytes.Buffer
+		err := json.Compact(&compact, []byte(req.Body))
+		if err != nil {
+			return req, errgo.Newf("invalid JSON body: %v", err)
+		}
+		req.Body = compact.String()
+	}
+	return req, nil
+}
+
+// balancedBraces returns true if the JSON body of the request is complete,
+// the braces in strings are ignored
+func balancedBraces(request string) bool {
+	depth := 0
+	inString := false
+	escaped := false
+	for _, r := range request {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && inString:
+			escaped = true
+		case r == '"':
+			inString = !inString
+		case inString:
+		case r == '{' || r == '[':
+			depth++
+		case r == '}' || r == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+func formatElasticsearchResponse(content []byte) string {
+	var indented bytes.Buffer
+	err := json.Indent(&indented, content, "", "  ")
+	if err != nil {
+		return strings.TrimRight(string(content), "\n")
+	}
+	return indented.String()
+}
@@ -0,0 +1,46 @@
+package db
+
+import "testing"
+
+func TestParseElasticsearchRequest(t *testing.T) {
+	cases := map[string]elasticsearchRequest{
+		"GET /_cat/indices?v": {Method: "GET", Path: "/_cat/indices?v"},
+		"/_cluster/health":    {Method: "GET", Path: "/_cluster/health"},
+		"delete myindex":      {Method: "DELETE", Path: "/myindex"},
+		"POST /myindex/_search {\n  \"query\": {\"match_all\": {}}\n}": {
+			Method: "POST", Path: "/myindex/_search", Body: `{"query":{"match_all":{}}}`,
+		},
+		`/myindex/_search{"size": 1}`: {Method: "GET", Path: "/myindex/_search", Body: `{"size":1}`},
+	}
+	for line, expected := range cases {
+		req, err := parseElasticsearchRequest(line)
+		if err != nil {
+			t.Fatal(line, err)
+		}
+		if req != expected {
+			t.Fatalf("%s: expected %+v, got %+v", line, expected, req)
+		}
+	}
+
+	for _, line := range []string{"FETCH /index", "GET", `POST /index {"invalid"}`} {
+		_, err := parseElasticsearchRequest(line)
+		if err == nil {
+			t.Fatalf("%s: expected an error", line)
+		}
+	}
+}
+
+func TestBalancedBraces(t *testing.T) {
+	cases := map[string]bool{
+		"GET /_search":                    true,
+		`POST /_search {"query": {`:       false,
+		`POST /_search {"query": "{"}`:    true,
+		`POST /_search {"query": "\"{"`:   false,
+		`POST /_bulk [{"index": {}}, {}]`: true,
+	}
+	for request, expected := range cases {
+		if balancedBraces(request) != expected {
+			t.Fatalf("%s: expected %v", request, expected)
+		}
+	}
+}
@@ -1,15 +1,31 @@
 package db
 
 import (
+	"bufio"
+	"fmt"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/term"
+	"github.com/Scalingo/go-scalingo"
 	"gopkg.in/errgo.v1"
 )
 
-func dbURL(app, envWord string, urlSchemes []string) (*url.URL, string, string, error) {
-	u, err := dbURLFromAPI(app, envWord, urlSchemes)
+// AddonSelector chooses the addon a database command targets when the
+// application has several addons of the same kind. Without selector, the user
+// is asked to choose among them.
+type AddonSelector struct {
+	// AddonID is the ID (or resource ID) of the addon
+	AddonID string
+	// EnvVar is the name of the variable containing the connection URL
+	EnvVar string
+}
+
+func dbURL(app, envWord string, urlSchemes []string, selector AddonSelector) (*url.URL, string, string, error) {
+	u, err := dbURLFromAPI(app, envWord, urlSchemes, selector)
 	if err != nil {
 		return nil, "", "", errgo.Mask(err)
 	}
@@ -27,21 +43,141 @@ func dbURL(app, envWord string, urlSchemes []string) (*url.URL, string, string,
 	return dbURL, user, password, nil
 }
 
-func dbURLFromAPI(app, envWord string, urlSchemes []string) (string, error) {
+func dbURLFromAPI(app, envWord string, urlSchemes []string, selector AddonSelector) (string, error) {
 	c := config.ScalingoClient()
 	environ, err := c.VariablesListWithoutAlias(app)
 	if err != nil {
 		return "", errgo.Mask(err)
 	}
+
+	if selector.EnvVar != "" {
+		variable, ok := environ.Contains(selector.EnvVar)
+		if !ok {
+			return "", errgo.Newf("no such environment variable: %s", selector.EnvVar)
+		}
+		if !hasScheme(variable.Value, urlSchemes) {
+			return "", errgo.Newf("%s is not a %s connection URL", selector.EnvVar, addonKind(envWord))
+		}
+		return variable.Value, nil
+	}
+
+	var candidates scalingo.Variables
 	for _, variable := range environ {
-		for _, scheme := range urlSchemes {
-			if strings.Contains(variable.Name, envWord) && strings.HasPrefix(variable.Value, scheme) {
-				return variable.Value, nil
-			}
+		if strings.Contains(variable.Name, envWord) && hasScheme(variable.Value, urlSchemes) && !containsValue(candidates, variable.Value) {
+			candidates = append(candidates, variable)
+		}
+	}
+	return selectAddonURL(app, addonKind(envWord), candidates, selector)
+}
+
+// selectAddonURL returns the URL of the addon among the candidates, using the
+// addon ID of the selector or asking the user if there are several of them.
+func selectAddonURL(app, kind string, candidates scalingo.Variables, selector AddonSelector) (string, error) {
+	var err error
+	if selector.AddonID != "" {
+		candidates, err = addonVariables(app, selector.AddonID, candidates)
+		if err != nil {
+			return "", errgo.Mask(err)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		if selector.AddonID != "" {
+			return "", errgo.Newf("no %v addon with the ID %s", kind, selector.AddonID)
 		}
+		return "", errgo.Newf("no %v addon detected", kind)
+	case 1:
+		return candidates[0].Value, nil
 	}
 
-	return "", errgo.Newf("no %v addon detected", strings.ToLower(envWord))
+	variable, err := chooseAddonVariable(kind, candidates)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return variable.Value, nil
+}
+
+// addonVariables keeps the variables containing the URL of the given addon.
+// Scalingo database URLs embed the resource ID of the addon as user, database
+// name or hostname.
+func addonVariables(app, addonID string, candidates scalingo.Variables) (scalingo.Variables, error) {
+	c := config.ScalingoClient()
+	addons, err := c.AddonsList(app)
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to list the addons of %s", app)
+	}
+
+	var addon *scalingo.Addon
+	for _, a := range addons {
+		if a.ID == addonID || a.ResourceID == addonID {
+			addon = a
+		}
+	}
+	if addon == nil {
+		return nil, errgo.Newf("no addon %s for the application %s", addonID, app)
+	}
+
+	return AddonVariables(addon, candidates), nil
+}
+
+// AddonVariables returns the variables containing an URL of the given addon
+func AddonVariables(addon *scalingo.Addon, variables scalingo.Variables) scalingo.Variables {
+	var res scalingo.Variables
+	for _, variable := range variables {
+		u, err := url.Parse(variable.Value)
+		if err != nil {
+			continue
+		}
+		if matchResourceID(u, addon.ResourceID) {
+			res = append(res, variable)
+		}
+	}
+	return res
+}
+
+func matchResourceID(u *url.URL, resourceID string) bool {
+	if resourceID == "" {
+		return false
+	}
+	if u.User != nil && u.User.Username() == resourceID {
+		return true
+	}
+	if strings.TrimPrefix(u.Path, "/") == resourceID {
+		return true
+	}
+	return strings.HasPrefix(u.Hostname(), strings.Replace(resourceID, "_", "-", -1)+".")
+}
+
+// chooseAddonVariable asks the user which addon to use, in non-interactive
+// mode an error listing the candidates is returned.
+func chooseAddonVariable(kind string, candidates scalingo.Variables) (*scalingo.Variable, error) {
+	var list []string
+	for _, variable := range candidates {
+		list = append(list, fmt.Sprintf("%s (%s)", variable.Name, urlHost(variable.Value)))
+	}
+
+	if config.C.DisableInteractive || !term.IsATTY(os.Stdin) {
+		return nil, errgo.Newf(
+			"several %s addons found, use --addon or --env-var to choose one:\n  %s",
+			kind, strings.Join(list, "\n  "),
+		)
+	}
+
+	fmt.Printf("Several %s addons are available:\n", kind)
+	for i, item := range list {
+		fmt.Printf("  %d) %s\n", i+1, item)
+	}
+	fmt.Printf("Which one do you want to use? [1-%d] ", len(list))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return nil, errgo.Newf("'%s' is not a valid choice", strings.TrimSpace(answer))
+	}
+	return candidates[choice-1], nil
 }
 
 func extractCredentials(u *url.URL) (string, string, error) {
@@ -56,3 +192,36 @@ func extractCredentials(u *url.URL) (string, string, error) {
 
 	return u.User.Username(), password, nil
 }
+
+// addonKind is the human name of the addon from the prefix of its variables,
+// e.g. SCALINGO_POSTGRESQL gives postgresql.
+func addonKind(envWord string) string {
+	return strings.ToLower(strings.TrimPrefix(envWord, "SCALINGO_"))
+}
+
+func hasScheme(value string, urlSchemes []string) bool {
+	for _, scheme := range urlSchemes {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(variables scalingo.Variables, value string) bool {
+	for _, variable := range variables {
+		if variable.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// urlHost returns the host of the URL, without exposing the credentials
+func urlHost(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return "invalid URL"
+	}
+	return u.Host
+}
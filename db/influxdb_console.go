@@ -1,48 +0,0 @@
-package db
-
-import (
-	"net"
-	"strings"
-
-	"github.com/Scalingo/cli/apps"
-	"gopkg.in/errgo.v1"
-)
-
-type InfluxDBConsoleOpts struct {
-	App  string
-	Size string
-}
-
-func InfluxDBConsole(opts InfluxDBConsoleOpts) error {
-	influxdbURL, username, password, err := dbURL(opts.App, "SCALINGO_INFLUX", []string{"http://", "https://"})
-	if err != nil {
-		return errgo.Mask(err)
-	}
-
-	host, port, err := net.SplitHostPort(influxdbURL.Host)
-	if err != nil {
-		return errgo.Newf("%v has an invalid host", influxdbURL)
-	}
-
-	cmd := []string{"dbclient-fetcher", "influxdb", "&&", "influx"}
-
-	if influxdbURL.Scheme == "https" {
-		cmd = append(cmd, "-ssl", "-unsafeSsl")
-	}
-
-	cmd = append(cmd, "-host", host, "-port", port, "-username", username, "-password", password, "-database", influxdbURL.Path[1:])
-
-	runOpts := apps.RunOpts{
-		DisplayCmd: "influxdb-console " + strings.Split(host, ".")[0],
-		App:        opts.App,
-		Cmd:        cmd,
-		Size:       opts.Size,
-	}
-
-	err = apps.Run(runOpts)
-	if err != nil {
-		return errgo.Newf("Fail to run InfluxDB console: %v", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+
+	"github.com/Scalingo/cli/debug"
+	netssh "github.com/Scalingo/cli/net/ssh"
+	"github.com/Scalingo/cli/net/tcp"
+	"github.com/Scalingo/cli/signals"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/errgo.v1"
+)
+
+// localConsoleCmd returns the arguments, the additional environment and the
+// script of the database client, host and port being the local end of the
+// tunnel.
+type localConsoleCmd func(host, port string) (args []string, env []string, script string)
+
+// runLocalConsole builds a tunnel to the database on a free local port and
+// runs the client installed locally through it. The script, if any, is given
+// in a temporary file readable by the user only. The tunnel is torn down and
+// the script removed when the client exits.
+func runLocalConsole(dbURL *url.URL, opts ConsoleOpts, binary string, buildCmd localConsoleCmd) error {
+	binaryPath, err := exec.LookPath(binary)
+	if err != nil {
+		return errgo.Newf("'%s' is not installed locally, remove '--local' to run the console in a one-off container", binary)
+	}
+
+	return runLocalTunnel(dbURL, opts, func(host, port string) error {
+		args, env, script := buildCmd(host, port)
+		if script != "" {
+			scriptPath, err := writeScript(script)
+			if err != nil {
+				return errgo.Mask(err)
+			}
+			defer os.Remove(scriptPath)
+			args = append(args, scriptPath)
+		}
+		debug.Println("Running", binaryPath, "through the tunnel", net.JoinHostPort(host, port))
+
+		cmd := exec.Command(binaryPath, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), env...)
+
+		// Interruptions are meant for the client, which receives them as well
+		signals.CatchQuitSignals = false
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+		defer signal.Stop(interrupts)
+
+		err = cmd.Run()
+		if err != nil {
+			if _, ok := err.(*exec.ExitError); ok {
+				return errgo.Newf("%s exited with an error: %v", binary, err)
+			}
+			return errgo.Notef(err, "fail to run %s", binary)
+		}
+		return nil
+	})
+}
+
+// runLocalTunnel builds a tunnel to the database on a free local port and
+// calls run with the local end of the tunnel, the tunnel is torn down when
+// it returns.
+func runLocalTunnel(dbURL *url.URL, opts ConsoleOpts, run func(host, port string) error) error {
+	client, key, err := netssh.Connect(netssh.ConnectOpts{Identity: opts.Identity, HostKey: opts.HostKey})
+	if err != nil {
+		if err == netssh.ErrNoAuthSucceed {
+			return errgo.Notef(err, "no SSH key can be used to build the tunnel to the database")
+		}
+		return errgo.Notef(err, "fail to connect to SSH server")
+	}
+
+	// Port 0 lets the system choose a free port
+	sock, err := tcp.Listen(0)
+	if err != nil {
+		client.Close()
+		return errgo.Mask(err)
+	}
+
+	session := newTunnelSession(TunnelOpts{Identity: opts.Identity, HostKey: opts.HostKey}, client, key)
+	session.quiet = true
+	session.sockets = append(session.sockets, sock)
+	defer session.close()
+
+	go session.serve(sock, func(client *ssh.Client, connID int, conn *net.TCPConn) error {
+		return session.handleConnToTunnel(client, dbURL.Host, connID, conn)
+	})
+	go func() {
+		for {
+			select {
+			case err := <-session.errs:
+				debug.Println("Error in the tunnel to the database", err)
+			case <-session.done:
+				return
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(sock.Addr().String())
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return run(host, port)
+}
+
+// writeScript writes the script of the client in a temporary file, it may
+// contain credentials
+func writeScript(script string) (string, error) {
+	fd, err := ioutil.TempFile("", "scalingo-console-*.js")
+	if err != nil {
+		return "", errgo.Notef(err, "fail to create the script of the client")
+	}
+	defer fd.Close()
+	_, err = fd.WriteString(script)
+	if err != nil {
+		os.Remove(fd.Name())
+		return "", errgo.Notef(err, "fail to write the script of the client")
+	}
+	return fd.Name(), nil
+}
+
+// localURL returns a copy of u targeting the local end of the tunnel.
+func localURL(u *url.URL, host, port string) *url.URL {
+	local := *u
+	local.Host = net.JoinHostPort(host, port)
+	return &local
+}
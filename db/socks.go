@@ -0,0 +1,175 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	stdio "io"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/Scalingo/cli/debug"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/errgo.v1"
+)
+
+// SOCKS5 protocol, RFC 1928, only the CONNECT command without authentication
+// is supported.
+const (
+	socksVersion        = 0x05
+	socksNoAuth         = 0x00
+	socksNoAcceptable   = 0xff
+	socksCmdConnect     = 0x01
+	socksAddrIPv4       = 0x01
+	socksAddrDomain     = 0x03
+	socksAddrIPv6       = 0x04
+	socksSucceeded      = 0x00
+	socksNotAllowed     = 0x02
+	socksUnreachable    = 0x04
+	socksCmdNotSupport  = 0x07
+	socksAddrNotSupport = 0x08
+)
+
+// socksAllowList contains the addresses the SOCKS proxy accepts to connect
+// to: the hosts of the addons of the application, and their IP addresses
+// for clients resolving the hostnames by themselves.
+type socksAllowList map[string]bool
+
+func newSocksAllowList(targets []*tunnelTarget) socksAllowList {
+	allowed := socksAllowList{}
+	for _, target := range targets {
+		allowed[target.dbURL.Host] = true
+		host, port, err := net.SplitHostPort(target.dbURL.Host)
+		if err != nil {
+			continue
+		}
+		ips, err := net.LookupHost(host)
+		if err != nil {
+			debug.Println("fail to resolve", host, err)
+			continue
+		}
+		for _, ip := range ips {
+			allowed[net.JoinHostPort(ip, port)] = true
+		}
+	}
+	return allowed
+}
+
+func printSocksProxy(sock net.Listener, targets []*tunnelTarget) {
+	fmt.Fprintln(os.Stderr, "SOCKS5 proxy giving access to:")
+	for _, target := range targets {
+		fmt.Fprintf(os.Stderr, "  %s (%s)\n", target.name, target.dbURL.Host)
+	}
+	fmt.Fprintln(os.Stderr, "You can use the proxy on:")
+	fmt.Printf("%v\n", sock.Addr())
+}
+
+func (s *tunnelSession) handleSocksConn(sshClient *ssh.Client, allowed socksAllowList, connID int, sock net.Conn) error {
+	host, err := socksHandshake(sock)
+	if err != nil {
+		debug.Println("SOCKS handshake failed", connID, err)
+		sock.Close()
+		return nil
+	}
+	if !allowed[host] {
+		fmt.Fprintf(os.Stderr, "Connection to %s refused, it is not an addon of the application [%d]\n", host, connID)
+		socksReply(sock, socksNotAllowed)
+		sock.Close()
+		return nil
+	}
+
+	s.printf("Connect to %s [%v]\n", host, connID)
+	conn, err := sshClient.Dial("tcp", host)
+	if err != nil {
+		socksReply(sock, socksUnreachable)
+		s.connFailed(host, connID, sock, err)
+		return nil
+	}
+	err = socksReply(sock, socksSucceeded)
+	if err != nil {
+		conn.Close()
+		sock.Close()
+		return nil
+	}
+	return s.pipe(host, connID, sock, conn)
+}
+
+// socksHandshake negotiates the authentication method and reads the CONNECT
+// request of the client, the requested address is returned as host:port.
+func socksHandshake(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	_, err := stdio.ReadFull(conn, header)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	if header[0] != socksVersion {
+		return "", errgo.Newf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	_, err = stdio.ReadFull(conn, methods)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	_, err = conn.Write([]byte{socksVersion, method})
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	if method == socksNoAcceptable {
+		return "", errgo.New("no supported authentication method")
+	}
+
+	request := make([]byte, 4)
+	_, err = stdio.ReadFull(conn, request)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	if request[1] != socksCmdConnect {
+		socksReply(conn, socksCmdNotSupport)
+		return "", errgo.Newf("unsupported SOCKS command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksAddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		_, err = stdio.ReadFull(conn, ip)
+		host = ip.String()
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		_, err = stdio.ReadFull(conn, length)
+		if err == nil {
+			domain := make([]byte, length[0])
+			_, err = stdio.ReadFull(conn, domain)
+			host = string(domain)
+		}
+	default:
+		socksReply(conn, socksAddrNotSupport)
+		return "", errgo.Newf("unsupported SOCKS address type %d", request[3])
+	}
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+
+	port := make([]byte, 2)
+	_, err = stdio.ReadFull(conn, port)
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksReply answers to the CONNECT request, the bound address is not
+// meaningful through the tunnel and is always 0.0.0.0:0.
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"bytes"
+	stdio "io"
+	"net"
+	"testing"
+)
+
+func TestSocksHandshake(t *testing.T) {
+	cases := []struct {
+		request  []byte
+		expected string
+	}{
+		{
+			request:  []byte{0x05, 0x01, 0x00, 0x01, 10, 0, 0, 1, 0x75, 0x30},
+			expected: "10.0.0.1:30000",
+		}, {
+			request:  append(append([]byte{0x05, 0x01, 0x00, 0x03, 12}, "scalingo.com"...), 0x00, 0x50),
+			expected: "scalingo.com:80",
+		},
+	}
+
+	for _, c := range cases {
+		client, server := net.Pipe()
+		go func() {
+			client.Write([]byte{0x05, 0x01, 0x00})
+			answer := make([]byte, 2)
+			stdio.ReadFull(client, answer)
+			if !bytes.Equal(answer, []byte{0x05, 0x00}) {
+				t.Errorf("expected no authentication to be selected, got %v", answer)
+			}
+			client.Write(c.request)
+		}()
+
+		host, err := socksHandshake(server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host != c.expected {
+			t.Fatalf("expected %s, got %s", c.expected, host)
+		}
+		client.Close()
+		server.Close()
+	}
+}
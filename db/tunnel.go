@@ -3,36 +3,61 @@ package db
 import (
 	"errors"
 	"fmt"
-	stdio "io"
 	"net"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
-	"sync"
-	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/Scalingo/cli/config"
-	"github.com/Scalingo/cli/debug"
-	"github.com/Scalingo/cli/io"
 	netssh "github.com/Scalingo/cli/net/ssh"
+	"github.com/Scalingo/cli/net/tcp"
 	"github.com/Scalingo/go-scalingo"
 	"golang.org/x/crypto/ssh"
 	"gopkg.in/errgo.v1"
 )
 
 var (
-	errTimeout      = errors.New("timeout")
-	connIDGenerator = make(chan int)
-	defaultPort     = 10000
+	errTimeout  = errors.New("timeout")
+	defaultPort = 10000
 )
 
 type TunnelOpts struct {
 	App       string
-	DBEnvVar  string
+	DBEnvVars []string
+	All       bool
+	// Addon is the ID of the addon to reach, instead of DBEnvVars
+	Addon     string
 	Identity  string
 	Port      int
 	Reconnect bool
+	HostKey   netssh.HostKeyOpts
+	// IdleTimeout closes the local connections without any traffic for this
+	// duration, 0 disables it.
+	IdleTimeout time.Duration
+	// MaxConnections is the maximal number of local connections open at the
+	// same time, 0 means no limit.
+	MaxConnections int
+	// SocksPort starts a SOCKS5 proxy on this port instead of one tunnel per
+	// addon, only the addons of the application can be reached through it.
+	SocksPort int
+}
+
+// tunnelTarget is an addon reached through the SSH connection, its local end
+// is bound on its own port.
+type tunnelTarget struct {
+	name  string
+	dbURL *url.URL
+	sock  *net.TCPListener
+}
+
+// localURL is the connection URL of the addon, through the tunnel.
+func (t *tunnelTarget) localURL() string {
+	u := *t.dbURL
+	u.Host = t.sock.Addr().String()
+	return u.String()
 }
 
 func Tunnel(opts TunnelOpts) error {
@@ -42,165 +67,171 @@ func Tunnel(opts TunnelOpts) error {
 		return errgo.Mask(err)
 	}
 
-	dbUrlStr := dbEnvVarValue(opts.DBEnvVar, environ)
-	if dbUrlStr == "" {
-		return errgo.Newf("no such environment variable: %s", opts.DBEnvVar)
-	}
-
-	dbUrl, err := url.Parse(dbUrlStr)
+	targets, err := tunnelTargets(opts, environ)
 	if err != nil {
-		return errgo.Notef(err, "invalid database 'URL': %s", dbUrlStr)
+		return errgo.Mask(err)
+	}
+	for _, target := range targets {
+		fmt.Fprintf(os.Stderr, "Building tunnel to %s\n", target.dbURL.Host)
 	}
-	fmt.Fprintf(os.Stderr, "Building tunnel to %s\n", dbUrl.Host)
 
-	client, key, err := netssh.Connect(opts.Identity)
+	client, key, err := netssh.Connect(netssh.ConnectOpts{Identity: opts.Identity, HostKey: opts.HostKey})
 	if err != nil {
 		if err == netssh.ErrNoAuthSucceed {
 			return errgo.Notef(err, "please use the flag '-i /path/to/private/key' to specify your private key")
 		}
 		return errgo.Notef(err, "fail to connect to SSH server")
 	}
-	waitingConnectionM := &sync.Mutex{}
 
 	if opts.Port == 0 {
 		opts.Port = defaultPort
 	}
 
-	var tcpAddr *net.TCPAddr
-	var sock *net.TCPListener
-	for {
-		tcpAddr, err = net.ResolveTCPAddr("tcp", fmt.Sprintf("localhost:%d", opts.Port))
+	session := newTunnelSession(opts, client, key)
+	go session.keepAlive()
+
+	if opts.SocksPort != 0 {
+		sock, err := tcp.Listen(opts.SocksPort)
 		if err != nil {
 			return errgo.Mask(err)
 		}
+		defer sock.Close()
+		printSocksProxy(sock, targets)
+
+		allowed := newSocksAllowList(targets)
+		session.sockets = append(session.sockets, sock)
+		go session.serve(sock, func(client *ssh.Client, connID int, conn *net.TCPConn) error {
+			return session.handleSocksConn(client, allowed, connID, conn)
+		})
+		return errgo.Mask(session.wait())
+	}
 
-		sock, err = net.ListenTCP("tcp", tcpAddr)
-		if isAddrInUse(err) {
-			opts.Port++
-			continue
-		}
+	port := opts.Port
+	for _, target := range targets {
+		target.sock, err = tcp.Listen(port)
 		if err != nil {
 			return errgo.Mask(err)
 		}
-		break
+		defer target.sock.Close()
+		session.sockets = append(session.sockets, target.sock)
+		port = target.sock.Addr().(*net.TCPAddr).Port + 1
+	}
+	printTunnels(targets)
+
+	for _, target := range targets {
+		go func(target *tunnelTarget) {
+			session.serve(target.sock, func(client *ssh.Client, connID int, conn *net.TCPConn) error {
+				return session.handleConnToTunnel(client, target.dbURL.Host, connID, conn)
+			})
+		}(target)
 	}
 
-	defer sock.Close()
-	fmt.Fprintln(os.Stderr, "You can access your database on:")
-	fmt.Printf("%v\n", sock.Addr())
+	return errgo.Mask(session.wait())
+}
 
-	go startIDGenerator()
-	errs := make(chan error)
-	for {
-		select {
-		case err := <-errs:
-			return errgo.Mask(err)
-		default:
+func tunnelTargets(opts TunnelOpts, environ scalingo.Variables) ([]*tunnelTarget, error) {
+	dbEnvVars := opts.DBEnvVars
+	// The SOCKS proxy gives access to all the addons unless some are given
+	if opts.All || (opts.SocksPort != 0 && len(dbEnvVars) == 0) {
+		dbEnvVars = addonEnvVars(environ)
+		if len(dbEnvVars) == 0 {
+			return nil, errgo.New("no addon detected in the environment of the application")
 		}
+	}
 
-		debug.Println("Waiting local connection request")
-		connToTunnel, err := sock.AcceptTCP()
+	if opts.Addon != "" {
+		var candidates scalingo.Variables
+		for _, name := range addonEnvVars(environ) {
+			variable, _ := environ.Contains(name)
+			candidates = append(candidates, variable)
+		}
+		variables, err := addonVariables(opts.App, opts.Addon, candidates)
 		if err != nil {
-			return errgo.Mask(err)
+			return nil, errgo.Mask(err)
 		}
-		debug.Println("New local connection")
-		// Checking not in reconnection process
-		waitingConnectionM.Lock()
-		waitingConnectionM.Unlock()
-
-		go func() {
-			for {
-				err := handleConnToTunnel(client, dbUrl, connToTunnel, errs)
-				if err != nil {
-					debug.Println("Error happened in tunnel", err)
-					if !opts.Reconnect {
-						errs <- err
-						return
-					}
-				}
-				if err == errTimeout {
-					waitingConnectionM.Lock()
-					fmt.Println("Connection broken, reconnecting...")
-					for err != nil {
-						client, err = netssh.ConnectToSSHServerWithKey(key)
-						if err != nil {
-							fmt.Println("Fail to reconnect, waiting 10 seconds...")
-							time.Sleep(10 * time.Second)
-						}
-					}
-					fmt.Println("Reconnected!")
-					waitingConnectionM.Unlock()
-				}
-				break
-			}
-		}()
+		if len(variables) == 0 {
+			return nil, errgo.Newf("no connection URL found for the addon %s", opts.Addon)
+		}
+		dbEnvVars = []string{variables[0].Name}
 	}
-}
 
-func dbEnvVarValue(dbEnvVar string, environ scalingo.Variables) string {
-	for _, env := range environ {
-		if env.Value == dbEnvVar {
-			return dbEnvVar
+	var targets []*tunnelTarget
+	for _, dbEnvVar := range dbEnvVars {
+		dbUrlStr := dbEnvVarValue(dbEnvVar, environ)
+		if dbUrlStr == "" {
+			return nil, errgo.Newf("no such environment variable: %s", dbEnvVar)
 		}
-		if env.Name == dbEnvVar {
-			return env.Value
+
+		dbUrl, err := url.Parse(dbUrlStr)
+		if err != nil {
+			return nil, errgo.Notef(err, "invalid database 'URL': %s", dbUrlStr)
+		}
+
+		name := dbEnvVar
+		if name == dbUrlStr {
+			name = dbUrl.Host
 		}
+		targets = append(targets, &tunnelTarget{name: name, dbURL: dbUrl})
 	}
-	return ""
+	return targets, nil
 }
 
-func handleConnToTunnel(sshClient *ssh.Client, dbUrl *url.URL, sock net.Conn, errs chan error) error {
-	connID := <-connIDGenerator
-	fmt.Printf("Connect to %s [%v]\n", dbUrl.Host, connID)
-	conn, err := sshClient.Dial("tcp", dbUrl.Host)
-	if err != nil {
-		if err != stdio.EOF {
-			errs <- err
+// addonEnvVars returns the names of the variables containing the connection
+// URL of an addon: SCALINGO_*_URL variables with credentials.
+func addonEnvVars(environ scalingo.Variables) []string {
+	var names []string
+	urls := map[string]bool{}
+	for _, env := range environ {
+		if !strings.HasPrefix(env.Name, "SCALINGO_") || !strings.HasSuffix(env.Name, "_URL") || urls[env.Value] {
+			continue
 		}
-		return nil
+		u, err := url.Parse(env.Value)
+		if err != nil || u.Host == "" || u.User == nil {
+			continue
+		}
+		urls[env.Value] = true
+		names = append(names, env.Name)
 	}
-	debug.Println("Connected to", dbUrl.Host, connID)
-
-	wg := &sync.WaitGroup{}
-	wg.Add(2)
-
-	go func() {
-		debug.Println("Pipe DB -> Local ON")
-		_, remoteErr := stdio.Copy(sock, conn)
-		debug.Println("Pipe DB -> Local OFF", remoteErr)
-		sock.Close()
-		wg.Done()
-	}()
-
-	go func() {
-		debug.Println("Local -> DB ON")
-		_, err = io.CopyWithTimeout(2*time.Second)(conn, sock)
-		debug.Println("Local -> DB OFF", err)
-		conn.Close()
-		wg.Done()
-	}()
+	sort.Strings(names)
+	return names
+}
 
-	wg.Wait()
+// printTunnels displays the local address of each tunnel on stdout. When
+// several tunnels are built, the connection URLs are displayed along.
+func printTunnels(targets []*tunnelTarget) {
+	if len(targets) == 1 {
+		fmt.Fprintln(os.Stderr, "You can access your database on:")
+		fmt.Printf("%v\n", targets[0].sock.Addr())
+		fmt.Fprintf(os.Stderr, "Connection URL: %s\n", targets[0].localURL())
+		return
+	}
 
-	fmt.Printf("End of connection [%d]\n", connID)
-	// Connection timeout
-	if err != nil && strings.Contains(err.Error(), "use of closed network") {
-		return errTimeout
+	fmt.Fprintln(os.Stderr, "You can access your databases on:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, target := range targets {
+		fmt.Fprintf(w, "%s\t%v\t%s\n", target.name, target.sock.Addr(), target.localURL())
 	}
-	return nil
+	w.Flush()
 }
 
-func startIDGenerator() {
-	for i := 1; ; i++ {
-		connIDGenerator <- i
+func dbEnvVarValue(dbEnvVar string, environ scalingo.Variables) string {
+	for _, env := range environ {
+		if env.Value == dbEnvVar {
+			return dbEnvVar
+		}
+		if env.Name == dbEnvVar {
+			return env.Value
+		}
 	}
+	return ""
 }
 
-func isAddrInUse(err error) bool {
-	if err, ok := err.(*net.OpError); ok {
-		if err, ok := err.Err.(*os.SyscallError); ok {
-			return err.Err == syscall.EADDRINUSE
-		}
+func (s *tunnelSession) handleConnToTunnel(sshClient *ssh.Client, host string, connID int, sock net.Conn) error {
+	s.printf("Connect to %s [%v]\n", host, connID)
+	conn, err := sshClient.Dial("tcp", host)
+	if err != nil {
+		s.connFailed(host, connID, sock, err)
+		return nil
 	}
-	return false
+	return s.pipe(host, connID, sock, conn)
 }
@@ -0,0 +1,393 @@
+package db
+
+import (
+	"fmt"
+	stdio "io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Scalingo/cli/debug"
+	"github.com/Scalingo/cli/io"
+	netssh "github.com/Scalingo/cli/net/ssh"
+	"github.com/Scalingo/cli/net/tcp"
+	"github.com/Scalingo/cli/signals"
+	humanize "github.com/dustin/go-humanize"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/errgo.v1"
+)
+
+var (
+	keepAliveInterval = 30 * time.Second
+	keepAliveTimeout  = 15 * time.Second
+)
+
+// tunnelConnHandler handles a local connection accepted by a tunnel, through
+// the given SSH client.
+type tunnelConnHandler func(client *ssh.Client, connID int, conn *net.TCPConn) error
+
+// tunnelStats are the counters of a tunnel session, all the fields are
+// updated atomically.
+type tunnelStats struct {
+	activeConns int64
+	totalConns  int64
+	bytesIn     int64
+	bytesOut    int64
+	reconnects  int64
+}
+
+func (s *tunnelStats) print() {
+	fmt.Fprintf(os.Stderr,
+		"Tunnel status: %d active connection(s), %d in total, %s received, %s sent, %d reconnection(s)\n",
+		atomic.LoadInt64(&s.activeConns), atomic.LoadInt64(&s.totalConns),
+		humanize.Bytes(uint64(atomic.LoadInt64(&s.bytesIn))), humanize.Bytes(uint64(atomic.LoadInt64(&s.bytesOut))),
+		atomic.LoadInt64(&s.reconnects),
+	)
+}
+
+// tunnelSession is the state shared by all the connections going through
+// the SSH connection: the SSH client itself, which is replaced when
+// reconnecting, and the counters of the tunnel.
+type tunnelSession struct {
+	opts    TunnelOpts
+	key     ssh.Signer
+	clientM *sync.RWMutex
+	client  *ssh.Client
+	stats   *tunnelStats
+	conns   *sync.WaitGroup
+	slots   chan struct{}
+	// errs receives the errors ending the session, they are dropped once
+	// done is closed
+	errs     chan error
+	done     chan struct{}
+	doneOnce sync.Once
+	sockets  []*net.TCPListener
+	closing  int32
+	// quiet only logs the events of the connections in debug mode, when
+	// the output belongs to another program
+	quiet bool
+}
+
+func newTunnelSession(opts TunnelOpts, client *ssh.Client, key ssh.Signer) *tunnelSession {
+	s := &tunnelSession{
+		opts:    opts,
+		key:     key,
+		clientM: &sync.RWMutex{},
+		client:  client,
+		stats:   &tunnelStats{},
+		conns:   &sync.WaitGroup{},
+		errs:    make(chan error),
+		done:    make(chan struct{}),
+	}
+	if opts.MaxConnections > 0 {
+		s.slots = make(chan struct{}, opts.MaxConnections)
+	}
+	return s
+}
+
+// sshClient returns the current SSH client, it blocks while reconnecting.
+func (s *tunnelSession) sshClient() *ssh.Client {
+	s.clientM.RLock()
+	defer s.clientM.RUnlock()
+	return s.client
+}
+
+func (s *tunnelSession) printf(format string, args ...interface{}) {
+	if s.quiet {
+		debug.Printf(format, args...)
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+func (s *tunnelSession) isClosing() bool {
+	return atomic.LoadInt32(&s.closing) == 1
+}
+
+// fail reports an error ending the session, nobody waits for it once the
+// session is over.
+func (s *tunnelSession) fail(err error) {
+	select {
+	case s.errs <- err:
+	case <-s.done:
+		debug.Println("Error in the tunnel after its end", err)
+	}
+}
+
+func (s *tunnelSession) end() {
+	s.doneOnce.Do(func() { close(s.done) })
+}
+
+// connFailed reports a local connection which can't go through the tunnel,
+// the connection is closed and the other ones are not affected.
+func (s *tunnelSession) connFailed(host string, connID int, sock net.Conn, err error) {
+	sock.Close()
+	if s.quiet {
+		debug.Printf("Fail to connect to %s: %v [%d]\n", host, err, connID)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Fail to connect to %s: %v [%d]\n", host, err, connID)
+}
+
+// serve handles the connections of the listener until it is closed, it must
+// be called in its own goroutine.
+func (s *tunnelSession) serve(sock *net.TCPListener, handle tunnelConnHandler) {
+	err := tcp.Serve(sock, func(connID int, connToTunnel *net.TCPConn) {
+		if !s.acquireSlot() {
+			s.printf("Connection refused, %d connections are already open [%d]\n", s.opts.MaxConnections, connID)
+			connToTunnel.Close()
+			return
+		}
+		defer s.releaseSlot()
+
+		client := s.sshClient()
+		err := handle(client, connID, connToTunnel)
+		if err != nil {
+			debug.Println("Error happened in tunnel", err)
+			if !s.opts.Reconnect {
+				s.fail(err)
+				return
+			}
+		}
+		if err == errTimeout {
+			s.reconnect(client)
+		}
+	})
+	if !s.isClosing() {
+		s.fail(err)
+	}
+}
+
+func (s *tunnelSession) acquireSlot() bool {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	s.conns.Add(1)
+	atomic.AddInt64(&s.stats.activeConns, 1)
+	atomic.AddInt64(&s.stats.totalConns, 1)
+	return true
+}
+
+func (s *tunnelSession) releaseSlot() {
+	atomic.AddInt64(&s.stats.activeConns, -1)
+	s.conns.Done()
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// reconnect replaces the broken SSH client, if another connection already
+// did it, nothing is done.
+func (s *tunnelSession) reconnect(broken *ssh.Client) {
+	s.clientM.Lock()
+	defer s.clientM.Unlock()
+	if s.client != broken || s.isClosing() {
+		return
+	}
+
+	s.printf("Connection broken, reconnecting...\n")
+	broken.Close()
+	for {
+		client, err := netssh.ConnectToSSHServerWithKey(s.key, s.opts.HostKey)
+		if err == nil {
+			s.client = client
+			break
+		}
+		s.printf("Fail to reconnect, waiting 10 seconds...\n")
+		time.Sleep(10 * time.Second)
+	}
+	atomic.AddInt64(&s.stats.reconnects, 1)
+	s.printf("Reconnected!\n")
+}
+
+// keepAlive periodically sends a request to the SSH server to detect a
+// broken connection before a local connection gets stuck on it.
+func (s *tunnelSession) keepAlive() {
+	for range time.Tick(keepAliveInterval) {
+		if s.isClosing() {
+			return
+		}
+		client := s.sshClient()
+		err := sendKeepAlive(client)
+		if err == nil {
+			continue
+		}
+		debug.Println("SSH keepalive failed", err)
+		if !s.opts.Reconnect {
+			s.fail(errgo.Notef(err, "SSH connection lost"))
+			return
+		}
+		s.reconnect(client)
+	}
+}
+
+func sendKeepAlive(client *ssh.Client) error {
+	res := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		res <- err
+	}()
+	select {
+	case err := <-res:
+		return err
+	case <-time.After(keepAliveTimeout):
+		return errgo.Newf("no answer to keepalive after %v", keepAliveTimeout)
+	}
+}
+
+// wait blocks until an error occurs in the tunnel or until the user
+// interrupts it. When interrupted, the sockets stop accepting connections
+// and the open connections are drained, unless interrupted a second time.
+func (s *tunnelSession) wait() error {
+	defer s.end()
+	signals.CatchQuitSignals = false
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	statsRequests := make(chan os.Signal, 1)
+	notifyStatsSignal(statsRequests)
+
+	for {
+		select {
+		case err := <-s.errs:
+			return err
+		case <-statsRequests:
+			s.stats.print()
+		case <-interrupts:
+			s.drain(interrupts)
+			return nil
+		}
+	}
+}
+
+func (s *tunnelSession) drain(interrupts chan os.Signal) {
+	atomic.StoreInt32(&s.closing, 1)
+	for _, sock := range s.sockets {
+		sock.Close()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(drained)
+	}()
+
+	active := atomic.LoadInt64(&s.stats.activeConns)
+	if active > 0 {
+		fmt.Fprintf(os.Stderr, "Waiting for %d connection(s) to end, press Ctrl-C again to force...\n", active)
+	}
+	for done := false; !done; {
+		select {
+		case <-drained:
+			done = true
+		case <-interrupts:
+			done = true
+		case err := <-s.errs:
+			debug.Println("Error while draining the tunnel", err)
+		}
+	}
+
+	s.sshClient().Close()
+	s.stats.print()
+}
+
+// close stops the session without waiting for the open connections
+func (s *tunnelSession) close() {
+	s.end()
+	atomic.StoreInt32(&s.closing, 1)
+	for _, sock := range s.sockets {
+		sock.Close()
+	}
+	s.sshClient().Close()
+}
+
+// pipe copies the data between the local connection and the connection opened
+// through the SSH tunnel until one of them is closed or until the connection
+// has been idle for too long.
+func (s *tunnelSession) pipe(host string, connID int, sock net.Conn, conn net.Conn) error {
+	debug.Println("Connected to", host, connID)
+
+	lastActivity := time.Now().UnixNano()
+	local := &trackedConn{Conn: sock, counter: &s.stats.bytesOut, lastActivity: &lastActivity}
+	remote := &trackedConn{Conn: conn, counter: &s.stats.bytesIn, lastActivity: &lastActivity}
+
+	var (
+		err    error
+		idle   int32
+		closed = make(chan struct{})
+	)
+	if s.opts.IdleTimeout > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-closed:
+					return
+				case <-ticker.C:
+				}
+				if time.Since(time.Unix(0, atomic.LoadInt64(&lastActivity))) > s.opts.IdleTimeout {
+					s.printf("Connection idle for %v, closing [%d]\n", s.opts.IdleTimeout, connID)
+					atomic.StoreInt32(&idle, 1)
+					sock.Close()
+					conn.Close()
+					return
+				}
+			}
+		}()
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+
+	go func() {
+		debug.Println("Pipe DB -> Local ON")
+		_, remoteErr := stdio.Copy(sock, remote)
+		debug.Println("Pipe DB -> Local OFF", remoteErr)
+		sock.Close()
+		wg.Done()
+	}()
+
+	go func() {
+		debug.Println("Local -> DB ON")
+		_, err = io.CopyWithTimeout(2*time.Second)(conn, local)
+		debug.Println("Local -> DB OFF", err)
+		conn.Close()
+		wg.Done()
+	}()
+
+	wg.Wait()
+	close(closed)
+
+	s.printf("End of connection [%d]\n", connID)
+	// Connection timeout
+	if err != nil && atomic.LoadInt32(&idle) == 0 && strings.Contains(err.Error(), "use of closed network") {
+		return errTimeout
+	}
+	return nil
+}
+
+// trackedConn counts the bytes read from the connection and records the time
+// of the last read.
+type trackedConn struct {
+	net.Conn
+	counter      *int64
+	lastActivity *int64
+}
+
+func (c *trackedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		atomic.AddInt64(c.counter, int64(n))
+		atomic.StoreInt64(c.lastActivity, time.Now().UnixNano())
+	}
+	return n, err
+}
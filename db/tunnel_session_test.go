@@ -0,0 +1,23 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTunnelSessionFailAfterEnd(t *testing.T) {
+	s := newTunnelSession(TunnelOpts{}, nil, nil)
+	s.end()
+
+	failed := make(chan struct{})
+	go func() {
+		s.fail(errors.New("connection lost"))
+		close(failed)
+	}()
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("an error reported after the end of the session should not block")
+	}
+}
@@ -0,0 +1,9 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package db
+
+import "os"
+
+// notifyStatsSignal does nothing, SIGUSR1 is not relayed on this system
+func notifyStatsSignal(c chan os.Signal) {
+}
@@ -0,0 +1,14 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package db
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyStatsSignal relays SIGUSR1, used to display the status of a tunnel
+func notifyStatsSignal(c chan os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
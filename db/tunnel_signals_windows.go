@@ -0,0 +1,7 @@
+package db
+
+import "os"
+
+// notifyStatsSignal does nothing, there is no SIGUSR1 on Windows
+func notifyStatsSignal(c chan os.Signal) {
+}
@@ -0,0 +1,117 @@
+package domains
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// checkCertificate verifies locally the certificate and the key before they
+// are sent: the key must match the certificate, the chain must be complete
+// and ordered, the certificate must be valid and cover the domain.
+func checkCertificate(domain string, certContent, keyContent []byte) error {
+	certs, err := parseCertificates(certContent)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	_, err = tls.X509KeyPair(certContent, keyContent)
+	if err != nil {
+		return errgo.Notef(err, "the key doesn't match the certificate")
+	}
+	return checkChain(domain, certs, nil, time.Now())
+}
+
+// parseCertificates reads the certificates of a PEM file, in their order
+func parseCertificates(content []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errgo.Notef(err, "invalid certificate #%d", len(certs)+1)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errgo.New("no PEM encoded certificate found")
+	}
+	return certs, nil
+}
+
+// checkChain checks the certificate of the domain, which comes first, and
+// the intermediate certificates following it. The chain must lead to one of
+// the roots, the ones of the system if roots is nil.
+func checkChain(domain string, certs []*x509.Certificate, roots *x509.CertPool, now time.Time) error {
+	leaf := certs[0]
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return errgo.Newf("the certificate is not valid for %s, it covers: %s", domain, certificateNames(leaf))
+	}
+
+	for i, cert := range certs {
+		if now.After(cert.NotAfter) {
+			return errgo.Newf("the certificate %s expired on %s", certificateName(cert), cert.NotAfter.Format(time.RFC1123))
+		}
+		if now.Before(cert.NotBefore) {
+			return errgo.Newf("the certificate %s is not valid before %s", certificateName(cert), cert.NotBefore.Format(time.RFC1123))
+		}
+		if i == len(certs)-1 {
+			break
+		}
+		if err := cert.CheckSignatureFrom(certs[i+1]); err != nil {
+			return errgo.Newf("the chain is not ordered: the certificate %s is not issued by the next one (%s), "+
+				"the certificate of the domain must be followed by its issuer, and so on",
+				certificateName(cert), certificateName(certs[i+1]))
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       domain,
+		Intermediates: intermediates,
+		Roots:         roots,
+		CurrentTime:   now,
+	})
+	if _, ok := err.(x509.UnknownAuthorityError); ok {
+		last := certs[len(certs)-1]
+		return errgo.Newf("the chain is incomplete: the certificate of the issuer '%s' is missing, "+
+			"append the intermediate certificates to the certificate file", last.Issuer.CommonName)
+	}
+	if err != nil {
+		return errgo.Notef(err, "invalid certificate")
+	}
+	return nil
+}
+
+func certificateName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return fmt.Sprintf("'%s'", cert.Subject.CommonName)
+	}
+	return fmt.Sprintf("'%s'", cert.Subject.String())
+}
+
+// certificateNames returns the names covered by the certificate
+func certificateNames(cert *x509.Certificate) string {
+	names := cert.DNSNames
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = []string{cert.Subject.CommonName}
+	}
+	if len(names) == 0 {
+		return "no domain"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,112 @@
+package domains
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, name string, issuer *testCertificate, notAfter time.Time) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	if issuer == nil || name != "example.com" {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.DNSNames = []string{"example.com", "www.example.com"}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{cert: cert, key: key}
+}
+
+func (c *testCertificate) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+func (c *testCertificate) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func TestCheckChain(t *testing.T) {
+	year := time.Now().Add(365 * 24 * time.Hour)
+	root := newTestCertificate(t, "Test Root", nil, year)
+	intermediate := newTestCertificate(t, "Test Intermediate", root, year)
+	leaf := newTestCertificate(t, "example.com", intermediate, year)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	now := time.Now()
+
+	err := checkChain("www.example.com", []*x509.Certificate{leaf.cert, intermediate.cert}, roots, now)
+	if err != nil {
+		t.Fatal("the chain should be valid, got", err)
+	}
+
+	cases := map[string]struct {
+		domain string
+		certs  []*x509.Certificate
+		now    time.Time
+	}{
+		"other domain":         {"example.org", []*x509.Certificate{leaf.cert, intermediate.cert}, now},
+		"missing intermediate": {"example.com", []*x509.Certificate{leaf.cert}, now},
+		"wrong order":          {"example.com", []*x509.Certificate{leaf.cert, root.cert, intermediate.cert}, now},
+		"expired":              {"example.com", []*x509.Certificate{leaf.cert, intermediate.cert}, year.Add(time.Hour)},
+	}
+	for name, c := range cases {
+		if err := checkChain(c.domain, c.certs, roots, c.now); err == nil {
+			t.Fatal(name, "should be invalid")
+		}
+	}
+}
+
+func TestCheckCertificateKeyMismatch(t *testing.T) {
+	year := time.Now().Add(365 * 24 * time.Hour)
+	root := newTestCertificate(t, "Test Root", nil, year)
+	leaf := newTestCertificate(t, "example.com", root, year)
+	other := newTestCertificate(t, "example.com", root, year)
+
+	err := checkCertificate("example.com", leaf.pem(), other.keyPEM(t))
+	if err == nil {
+		t.Fatal("a key which doesn't match the certificate should be refused")
+	}
+
+	if _, err := parseCertificates(leaf.keyPEM(t)); err == nil {
+		t.Fatal("a file without certificate should be refused")
+	}
+}
@@ -0,0 +1,110 @@
+package domains
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/io"
+	"github.com/Scalingo/go-scalingo"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/errgo.v1"
+)
+
+// expiringWorkers is the number of applications whose domains are listed
+// concurrently
+const expiringWorkers = 8
+
+type appDomains struct {
+	app     string
+	domains []scalingo.Domain
+	err     error
+}
+
+type expiringDomain struct {
+	app    string
+	domain scalingo.Domain
+}
+
+// Expiring displays the custom certificates of all the applications which
+// expire within the given duration, it returns the number of certificates
+// found. An error is returned if the domains of an application can't be
+// listed, after the report of the other ones.
+func Expiring(within time.Duration) (int, error) {
+	c := config.ScalingoClient()
+	apps, err := c.AppsList()
+	if err != nil {
+		return 0, errgo.Mask(err, errgo.Any)
+	}
+
+	jobs := make(chan string)
+	results := make(chan appDomains)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < expiringWorkers && i < len(apps); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for app := range jobs {
+				domains, err := c.DomainsList(app)
+				results <- appDomains{app: app, domains: domains, err: err}
+			}
+		}()
+	}
+	go func() {
+		for _, app := range apps {
+			jobs <- app.Name
+		}
+		close(jobs)
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	limit := time.Now().Add(within)
+	var expiring []expiringDomain
+	var failures []string
+	for res := range results {
+		if res.err != nil {
+			config.C.Logger.Println("fail to list the domains of", res.app, res.err)
+			failures = append(failures, res.app)
+			continue
+		}
+		for _, domain := range res.domains {
+			if domain.SSL && domain.Validity.Before(limit) {
+				expiring = append(expiring, expiringDomain{app: res.app, domain: domain})
+			}
+		}
+	}
+
+	if len(expiring) == 0 {
+		io.Statusf("No custom certificate expires within %s.\n", formatWithin(within))
+	} else {
+		sort.Slice(expiring, func(i, j int) bool {
+			return expiring[i].domain.Validity.Before(expiring[j].domain.Validity)
+		})
+		t := tablewriter.NewWriter(os.Stdout)
+		t.SetHeader([]string{"App", "Domain", "Valid until", "Expires in"})
+		for _, e := range expiring {
+			t.Append([]string{e.app, e.domain.Name, e.domain.Validity.UTC().Format(time.RFC1123), daysLeft(e.domain.Validity)})
+		}
+		t.Render()
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return len(expiring), errgo.Newf("fail to list the domains of %s", strings.Join(failures, ", "))
+	}
+	return len(expiring), nil
+}
+
+func formatWithin(within time.Duration) string {
+	if within%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", within/(24*time.Hour))
+	}
+	return within.String()
+}
@@ -1,11 +1,19 @@
 package domains
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
 
-	"gopkg.in/errgo.v1"
 	"github.com/Scalingo/cli/config"
 	"github.com/Scalingo/cli/io"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/errgo.v1"
 )
 
 func DisableSSL(app string, domain string) error {
@@ -29,7 +37,7 @@ func EnableSSL(app, domain, certPath, keyPath string) error {
 		return errgo.Mask(err)
 	}
 
-	certContent, keyContent, err := validateSSL(certPath, keyPath)
+	certContent, keyContent, err := validateSSL(domain, certPath, keyPath)
 	if err != nil {
 		return errgo.Mask(err)
 	}
@@ -44,7 +52,9 @@ func EnableSSL(app, domain, certPath, keyPath string) error {
 	return nil
 }
 
-func validateSSL(cert, key string) (string, string, error) {
+// validateSSL reads the certificate and the key, and checks them locally to
+// report the common mistakes before sending them
+func validateSSL(domain, cert, key string) (string, string, error) {
 	if cert == "" && key == "" {
 		return "", "", nil
 	}
@@ -65,5 +75,77 @@ func validateSSL(cert, key string) (string, string, error) {
 	if err != nil {
 		return "", "", errgo.Mask(err)
 	}
+	err = checkCertificate(domain, certContent, keyContent)
+	if err != nil {
+		return "", "", errgo.Notef(err, "invalid certificate %s", cert)
+	}
 	return string(certContent), string(keyContent), nil
 }
+
+// InspectSSL displays the certificate installed for the domain. The
+// certificate is the one returned by the API, or the one presented by the
+// domain if the API doesn't return it.
+func InspectSSL(app, domain string) error {
+	d, err := findDomain(app, domain)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if !d.SSL {
+		io.Status("No custom certificate is installed for " + domain + ".")
+		return nil
+	}
+
+	var certs []*x509.Certificate
+	if d.TLSCert != "" {
+		certs, err = parseCertificates([]byte(d.TLSCert))
+	} else {
+		certs, err = servedCertificates(domain)
+	}
+	if err != nil {
+		io.Warning("Fail to get the certificate of " + domain + ": " + err.Error())
+	}
+
+	t := tablewriter.NewWriter(os.Stdout)
+	t.SetAutoWrapText(false)
+	t.Append([]string{"Domain", d.Name})
+	if len(certs) > 0 {
+		leaf := certs[0]
+		t.Append([]string{"Subject", leaf.Subject.CommonName})
+		t.Append([]string{"Issuer", leaf.Issuer.CommonName})
+		t.Append([]string{"Names", certificateNames(leaf)})
+		t.Append([]string{"Valid from", leaf.NotBefore.UTC().Format(time.RFC1123)})
+	}
+	t.Append([]string{"Valid until", fmt.Sprintf("%s (%s)", d.Validity.UTC().Format(time.RFC1123), daysLeft(d.Validity))})
+	if len(certs) > 1 {
+		var chain []string
+		for _, cert := range certs[1:] {
+			chain = append(chain, cert.Subject.CommonName)
+		}
+		t.Append([]string{"Chain", strings.Join(chain, " > ")})
+	}
+	t.Render()
+	return nil
+}
+
+// servedCertificates connects to the domain to get the certificates it
+// presents, they are inspected even if they are not valid
+func servedCertificates(domain string) ([]*x509.Certificate, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", domain+":443", &tls.Config{
+		ServerName:         domain,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates, nil
+}
+
+func daysLeft(validity time.Time) string {
+	days := int(time.Until(validity).Hours() / 24)
+	if days < 0 {
+		return io.BoldRed("expired")
+	}
+	return fmt.Sprintf("%d days left", days)
+}
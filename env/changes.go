@@ -0,0 +1,166 @@
+package env
+
+import (
+	"bufio"
+	"fmt"
+	stdio "io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/env/mask"
+	"github.com/Scalingo/cli/io"
+	"github.com/Scalingo/cli/term"
+	"github.com/Scalingo/go-scalingo"
+	"gopkg.in/errgo.v1"
+)
+
+// addonVariableName matches the variables created by the addons, they are
+// managed by the platform and never modified by the bulk commands.
+var addonVariableName = regexp.MustCompile(`^SCALINGO_[A-Z0-9_]+_URL(_[0-9]+)?$`)
+
+// Changes are the modifications needed to get from the current environment
+// of an application to a wanted one.
+type Changes struct {
+	Added     scalingo.Variables
+	Changed   scalingo.Variables
+	Unchanged scalingo.Variables
+	Removed   scalingo.Variables
+	// Ignored are the addon variables present in the wanted environment
+	Ignored scalingo.Variables
+
+	// current are the variables before the changes, to display the previous
+	// values and to find the IDs of the removed variables
+	current scalingo.Variables
+}
+
+// IsAddonVariable returns true if the variable is provided by an addon
+func IsAddonVariable(name string) bool {
+	return addonVariableName.MatchString(name)
+}
+
+// diffVariables compares the current variables with the wanted ones. When
+// prune is true, the current variables missing from the wanted ones are
+// removed, except the addon variables.
+func diffVariables(current, wanted scalingo.Variables, prune bool) Changes {
+	changes := Changes{current: current}
+	for _, variable := range wanted {
+		if IsAddonVariable(variable.Name) {
+			changes.Ignored = append(changes.Ignored, variable)
+			continue
+		}
+		existing, ok := current.Contains(variable.Name)
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, variable)
+		case existing.Value != variable.Value:
+			changes.Changed = append(changes.Changed, variable)
+		default:
+			changes.Unchanged = append(changes.Unchanged, variable)
+		}
+	}
+
+	if prune {
+		for _, variable := range current {
+			if _, ok := wanted.Contains(variable.Name); !ok && !IsAddonVariable(variable.Name) {
+				changes.Removed = append(changes.Removed, variable)
+			}
+		}
+	}
+	return changes
+}
+
+// IsEmpty returns true if there is nothing to apply
+func (c Changes) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Changed) == 0 && len(c.Removed) == 0
+}
+
+// Print displays the changes as a coloured diff, the values are masked unless
+// reveal is true.
+func (c Changes) Print(w stdio.Writer, reveal bool) {
+	display := func(variable *scalingo.Variable) string {
+		if reveal {
+			return variable.Value
+		}
+		return maskValue(variable.Name, variable.Value)
+	}
+
+	for _, variable := range sortedVariables(c.Added) {
+		fmt.Fprintln(w, io.Green(fmt.Sprintf("+ %s=%s", variable.Name, display(variable))))
+	}
+	for _, variable := range sortedVariables(c.Changed) {
+		previous, _ := c.current.Contains(variable.Name)
+		fmt.Fprintln(w, io.Yellow(fmt.Sprintf("~ %s=%s (was %s)", variable.Name, display(variable), display(previous))))
+	}
+	for _, variable := range sortedVariables(c.Removed) {
+		fmt.Fprintln(w, io.BoldRed(fmt.Sprintf("- %s", variable.Name)))
+	}
+	for _, variable := range sortedVariables(c.Ignored) {
+		fmt.Fprintln(w, io.Gray(fmt.Sprintf("  %s ignored, it is provided by an addon", variable.Name)))
+	}
+	fmt.Fprintf(w, "%d added, %d changed, %d removed, %d unchanged\n", len(c.Added), len(c.Changed), len(c.Removed), len(c.Unchanged))
+}
+
+// apply sets the added and changed variables in a single request, then
+// unsets the removed ones.
+func (c Changes) apply(app string) error {
+	client := config.ScalingoClient()
+	variables := append(scalingo.Variables{}, c.Added...)
+	variables = append(variables, c.Changed...)
+	if len(variables) > 0 {
+		_, _, err := client.VariableMultipleSet(app, variables)
+		if err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+	}
+
+	for _, variable := range c.Removed {
+		err := client.VariableUnset(app, variable.ID)
+		if err != nil {
+			return errgo.Notef(err, "fail to unset %s", variable.Name)
+		}
+	}
+	return nil
+}
+
+// confirmChanges asks the user to confirm the changes, unless yes is true. A
+// confirmation can't be asked in non-interactive mode, yes is mandatory.
+func confirmChanges(app string, yes bool) error {
+	if yes {
+		return nil
+	}
+	if config.C.DisableInteractive || !term.IsATTY(os.Stdin) {
+		return errgo.New("the changes need to be confirmed, use --yes in non-interactive mode")
+	}
+
+	fmt.Printf("Apply these changes to the environment of %s? (y/N) ", app)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != stdio.EOF {
+		return errgo.Mask(err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return errgo.New("aborting, the environment has not been modified")
+	}
+	return nil
+}
+
+func sortedVariables(variables scalingo.Variables) scalingo.Variables {
+	sorted := append(scalingo.Variables{}, variables...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// maskValue returns the value to display for a variable which may be a secret
+func maskValue(name, value string) string {
+	return mask.Variable(mask.Patterns(config.C.ScalingoSecretPatterns), name, value)
+}
+
+func printRestartHint(app string) {
+	fmt.Println("\nRestart your containers to apply these environment changes on your application:")
+	fmt.Printf("scalingo --app %s restart\n", app)
+}
@@ -0,0 +1,57 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/Scalingo/cli/env/dotenv"
+	"github.com/Scalingo/go-scalingo"
+)
+
+func TestDiffVariables(t *testing.T) {
+	current := scalingo.Variables{
+		{ID: "1", Name: "KEPT", Value: "same"},
+		{ID: "2", Name: "MODIFIED", Value: "old"},
+		{ID: "3", Name: "MISSING", Value: "value"},
+		{ID: "4", Name: "SCALINGO_REDIS_URL", Value: "redis://localhost"},
+	}
+	wanted := scalingo.Variables{
+		{Name: "KEPT", Value: "same"},
+		{Name: "MODIFIED", Value: "new"},
+		{Name: "NEW", Value: "value"},
+		{Name: "SCALINGO_POSTGRESQL_URL", Value: "postgres://localhost"},
+	}
+
+	changes := diffVariables(current, wanted, false)
+	if len(changes.Removed) != 0 {
+		t.Fatal("expected no variable to be removed without prune, got", len(changes.Removed))
+	}
+
+	changes = diffVariables(current, wanted, true)
+	expected := map[string]scalingo.Variables{
+		"NEW":                     changes.Added,
+		"MODIFIED":                changes.Changed,
+		"KEPT":                    changes.Unchanged,
+		"MISSING":                 changes.Removed,
+		"SCALINGO_POSTGRESQL_URL": changes.Ignored,
+	}
+	for name, variables := range expected {
+		if len(variables) != 1 || variables[0].Name != name {
+			t.Fatalf("expected only %s, got %v", name, variables)
+		}
+	}
+	if changes.Removed[0].ID != "3" {
+		t.Fatal("expected the ID of the removed variable to be kept, got", changes.Removed[0].ID)
+	}
+}
+
+func TestAnnotateEditorError(t *testing.T) {
+	content := "A=1\nB=\"unterminated\nC=3"
+	annotated := annotateEditorError(content, &dotenv.ParseError{Line: 2, Msg: "unterminated double quoted value"})
+	expected := "A=1\n" + editorErrorPrefix + "unterminated double quoted value\nB=\"unterminated\nC=3"
+	if annotated != expected {
+		t.Fatalf("expected %q, got %q", expected, annotated)
+	}
+	if removeEditorErrors(annotated) != content {
+		t.Fatalf("expected the annotation to be removed, got %q", removeEditorErrors(annotated))
+	}
+}
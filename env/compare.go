@@ -0,0 +1,149 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/io"
+	"github.com/Scalingo/go-scalingo"
+	"gopkg.in/errgo.v1"
+)
+
+// Diff displays the differences between the environments of two
+// applications. The addon variables are skipped, they are specific to each
+// application.
+func Diff(appA, appB string, reveal bool) error {
+	c := config.ScalingoClient()
+	varsA, err := c.VariablesList(appA)
+	if err != nil {
+		return errgo.Notef(err, "fail to list the variables of %s", appA)
+	}
+	varsB, err := c.VariablesList(appB)
+	if err != nil {
+		return errgo.Notef(err, "fail to list the variables of %s", appB)
+	}
+
+	display := func(variable *scalingo.Variable) string {
+		if reveal {
+			return variable.Value
+		}
+		return maskValue(variable.Name, variable.Value)
+	}
+
+	var onlyA, onlyB, different, identical int
+	for _, a := range sortedVariables(withoutAddonVariables(varsA)) {
+		b, ok := varsB.Contains(a.Name)
+		switch {
+		case !ok:
+			fmt.Println(io.BoldRed(fmt.Sprintf("< %s=%s", a.Name, display(a))))
+			onlyA++
+		case a.Value != b.Value:
+			fmt.Println(io.Yellow(fmt.Sprintf("~ %s: %s (%s) / %s (%s)", a.Name, display(a), appA, display(b), appB)))
+			different++
+		default:
+			identical++
+		}
+	}
+	for _, b := range sortedVariables(withoutAddonVariables(varsB)) {
+		if _, ok := varsA.Contains(b.Name); !ok {
+			fmt.Println(io.Green(fmt.Sprintf("> %s=%s", b.Name, display(b))))
+			onlyB++
+		}
+	}
+
+	fmt.Printf("%d only in %s, %d only in %s, %d different, %d identical\n", onlyA, appA, onlyB, appB, different, identical)
+	return nil
+}
+
+type CopyOpts struct {
+	From string
+	To   string
+	// Only is a regular expression, only the variables whose name matches
+	// it are copied
+	Only string
+	// Exclude is a regular expression, the variables whose name matches it
+	// are not copied
+	Exclude string
+	DryRun  bool
+	Yes     bool
+}
+
+// Copy sets the variables of an application on another one, in a single
+// request so that they are all copied or none of them. The addon variables
+// are never copied.
+func Copy(opts CopyOpts) error {
+	only, err := compileFilter("only", opts.Only)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	exclude, err := compileFilter("exclude", opts.Exclude)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	c := config.ScalingoClient()
+	source, err := c.VariablesList(opts.From)
+	if err != nil {
+		return errgo.Notef(err, "fail to list the variables of %s", opts.From)
+	}
+	current, err := c.VariablesList(opts.To)
+	if err != nil {
+		return errgo.Notef(err, "fail to list the variables of %s", opts.To)
+	}
+
+	var copied scalingo.Variables
+	for _, variable := range withoutAddonVariables(source) {
+		if only != nil && !only.MatchString(variable.Name) {
+			continue
+		}
+		if exclude != nil && exclude.MatchString(variable.Name) {
+			continue
+		}
+		copied = append(copied, &scalingo.Variable{Name: variable.Name, Value: variable.Value})
+	}
+	if len(copied) == 0 {
+		return errgo.Newf("no variable of %s to copy", opts.From)
+	}
+
+	changes := diffVariables(current, copied, false)
+	changes.Print(os.Stdout, false)
+	if changes.IsEmpty() || opts.DryRun {
+		return nil
+	}
+
+	err = confirmChanges(opts.To, opts.Yes)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	err = changes.apply(opts.To)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	fmt.Printf("%d variable(s) copied from %s to %s.\n", len(changes.Added)+len(changes.Changed), opts.From, opts.To)
+	printRestartHint(opts.To)
+	return nil
+}
+
+func compileFilter(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid --%s expression", name)
+	}
+	return re, nil
+}
+
+func withoutAddonVariables(vars scalingo.Variables) scalingo.Variables {
+	var res scalingo.Variables
+	for _, variable := range vars {
+		if !IsAddonVariable(variable.Name) {
+			res = append(res, variable)
+		}
+	}
+	return res
+}
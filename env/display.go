@@ -7,7 +7,14 @@ import (
 	"github.com/Scalingo/cli/config"
 )
 
-func Display(app string) error {
+type DisplayOpts struct {
+	// Reveal displays the values of the secrets
+	Reveal bool
+}
+
+// Display prints the environment of the application, the values of the
+// secrets are masked unless opts.Reveal is true.
+func Display(app string, opts DisplayOpts) error {
 	c := config.ScalingoClient()
 	vars, err := c.VariablesList(app)
 	if err != nil {
@@ -15,7 +22,27 @@ func Display(app string) error {
 	}
 
 	for _, v := range vars {
-		fmt.Printf("%s=%s\n", v.Name, v.Value)
+		value := v.Value
+		if !opts.Reveal {
+			value = maskValue(v.Name, v.Value)
+		}
+		fmt.Printf("%s=%s\n", v.Name, value)
+	}
+	return nil
+}
+
+// Get prints the raw value of a variable, to be used in scripts
+func Get(app, name string) error {
+	c := config.ScalingoClient()
+	vars, err := c.VariablesList(app)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	v, ok := vars.Contains(name)
+	if !ok {
+		return errgo.Newf("%s variable does not exist", name)
 	}
+	fmt.Println(v.Value)
 	return nil
 }
@@ -0,0 +1,272 @@
+package dotenv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Scalingo/go-scalingo"
+	"gopkg.in/errgo.v1"
+)
+
+var (
+	nameFormat = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]*$`)
+)
+
+// ParseError is returned when the content of a dotenv file can't be parsed,
+// Line is the line where the faulty variable starts.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", err.Line, err.Msg)
+}
+
+// ValidName returns true if name is accepted as a variable name in a dotenv
+// file
+func ValidName(name string) bool {
+	return nameFormat.MatchString(name)
+}
+
+// ParseFile reads and parses the dotenv file located at path, '-' reads from
+// the standard input.
+func ParseFile(path string) (scalingo.Variables, error) {
+	if path == "-" {
+		return Parse(os.Stdin)
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to open %s", path)
+	}
+	defer fd.Close()
+
+	vars, err := Parse(fd)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid env file %s", path)
+	}
+	return vars, nil
+}
+
+// Parse reads variables using the dotenv syntax:
+//
+//	# comment
+//	export NAME=value
+//	NAME=value # inline comment
+//	NAME='literal value, $HOME is not expanded'
+//	NAME="escaped\tvalue\nwith a new line"
+//	NAME="multiline
+//	value"
+//
+// Variables are returned in the order of the file, if a variable is defined
+// several times, the last definition wins.
+func Parse(r io.Reader) (scalingo.Variables, error) {
+	content, err := readAll(r)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+
+	p := &parser{content: []rune(content), line: 1}
+	vars := scalingo.Variables{}
+	for {
+		p.skipBlankAndComments()
+		if p.eof() {
+			break
+		}
+		startLine := p.line
+		name, value, err := p.parseVariable()
+		if err != nil {
+			return nil, &ParseError{Line: startLine, Msg: err.Error()}
+		}
+		if v, ok := vars.Contains(name); ok {
+			v.Value = value
+		} else {
+			vars = append(vars, &scalingo.Variable{Name: name, Value: value})
+		}
+	}
+	return vars, nil
+}
+
+func readAll(r io.Reader) (string, error) {
+	buffer := new(bytes.Buffer)
+	_, err := buffer.ReadFrom(bufio.NewReader(r))
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(buffer.String(), "\r\n", "\n", -1), nil
+}
+
+type parser struct {
+	content []rune
+	pos     int
+	line    int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.content)
+}
+
+func (p *parser) peek() rune {
+	return p.content[p.pos]
+}
+
+func (p *parser) next() rune {
+	r := p.content[p.pos]
+	p.pos++
+	if r == '\n' {
+		p.line++
+	}
+	return r
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+}
+
+func (p *parser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+func (p *parser) skipBlankAndComments() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\n':
+			p.next()
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) parseVariable() (string, string, error) {
+	name := p.readName()
+	if name == "export" {
+		p.skipSpaces()
+		if !p.eof() && p.peek() != '=' {
+			name = p.readName()
+		}
+	}
+	if !ValidName(name) {
+		return "", "", fmt.Errorf("invalid variable name '%s'", name)
+	}
+
+	p.skipSpaces()
+	if p.eof() || p.peek() != '=' {
+		return "", "", fmt.Errorf("format is invalid for '%s', accepted: VAR=VAL", name)
+	}
+	p.next()
+	p.skipSpaces()
+
+	if p.eof() {
+		return name, "", nil
+	}
+
+	var (
+		value string
+		err   error
+	)
+	switch p.peek() {
+	case '\'':
+		value, err = p.readSingleQuoted()
+	case '"':
+		value, err = p.readDoubleQuoted()
+	default:
+		return name, p.readUnquoted(), nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %v", name, err)
+	}
+
+	// Only spaces and a comment are allowed after a quoted value
+	p.skipSpaces()
+	if !p.eof() && p.peek() != '\n' && p.peek() != '#' {
+		return "", "", fmt.Errorf("%s: unexpected character '%c' after quoted value", name, p.peek())
+	}
+	p.skipLine()
+	return name, value, nil
+}
+
+func (p *parser) readName() string {
+	start := p.pos
+	for !p.eof() {
+		r := p.peek()
+		if r == '=' || r == ' ' || r == '\t' || r == '\n' {
+			break
+		}
+		p.next()
+	}
+	return string(p.content[start:p.pos])
+}
+
+func (p *parser) readUnquoted() string {
+	start := p.pos
+	for !p.eof() && p.peek() != '\n' {
+		// A '#' preceded by a space starts an inline comment
+		if p.peek() == '#' && p.pos > start && (p.content[p.pos-1] == ' ' || p.content[p.pos-1] == '\t') {
+			break
+		}
+		p.next()
+	}
+	value := strings.TrimSpace(string(p.content[start:p.pos]))
+	p.skipLine()
+	return value
+}
+
+func (p *parser) readSingleQuoted() (string, error) {
+	p.next()
+	start := p.pos
+	for !p.eof() {
+		if p.peek() == '\'' {
+			value := string(p.content[start:p.pos])
+			p.next()
+			return value, nil
+		}
+		p.next()
+	}
+	return "", errgo.New("unterminated single quoted value")
+}
+
+func (p *parser) readDoubleQuoted() (string, error) {
+	p.next()
+	buffer := new(bytes.Buffer)
+	for !p.eof() {
+		r := p.next()
+		switch r {
+		case '"':
+			return buffer.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", errgo.New("unterminated double quoted value")
+			}
+			escaped := p.next()
+			switch escaped {
+			case 'n':
+				buffer.WriteRune('\n')
+			case 'r':
+				buffer.WriteRune('\r')
+			case 't':
+				buffer.WriteRune('\t')
+			case '"', '\\', '$', '\'', '`':
+				buffer.WriteRune(escaped)
+			case '\n':
+				// Line continuation
+			default:
+				buffer.WriteRune('\\')
+				buffer.WriteRune(escaped)
+			}
+		default:
+			buffer.WriteRune(r)
+		}
+	}
+	return "", errgo.New("unterminated double quoted value")
+}
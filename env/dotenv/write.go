@@ -0,0 +1,40 @@
+package dotenv
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/Scalingo/go-scalingo"
+)
+
+var (
+	// safeValue matches the values which can be written without quotes
+	safeValue = regexp.MustCompile(`^[a-zA-Z0-9_./:@%+,-]*$`)
+
+	doubleQuoteEscaper = strings.NewReplacer(
+		`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`",
+		"\n", `\n`, "\r", `\r`, "\t", `\t`,
+	)
+)
+
+// Write writes the variables using the dotenv syntax, the values are quoted
+// when needed so that Parse reads them back unchanged.
+func Write(w io.Writer, vars scalingo.Variables) error {
+	for _, v := range vars {
+		_, err := fmt.Fprintf(w, "%s=%s\n", v.Name, Quote(v.Value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quote returns the value as written in a dotenv file
+func Quote(value string) string {
+	if safeValue.MatchString(value) {
+		return value
+	}
+	return `"` + doubleQuoteEscaper.Replace(value) + `"`
+}
@@ -3,6 +3,7 @@ package env
 import (
 	"errors"
 	"fmt"
+	"os"
 	"regexp"
 	"strings"
 
@@ -18,14 +19,42 @@ var (
 	errInvalidNameFormat = fmt.Errorf("name can only be composed with alphanumerical characters, hyphens and underscores")
 )
 
-func Add(app string, params []string) error {
+type AddOpts struct {
+	RestartOpts
+	// AllowEmpty accepts variables with an empty value
+	AllowEmpty bool
+}
+
+type DeleteOpts struct {
+	RestartOpts
+}
+
+func Add(app string, params []string, opts AddOpts) error {
+	resolver := &valueResolver{stdin: os.Stdin}
 	var variables scalingo.Variables
+	// The values read from files or generated are not displayed
+	descriptions := map[string]string{}
 	for _, param := range params {
-		if err := isEnvEditValid(param); err != nil {
+		if err := isEnvEditValid(param, opts.AllowEmpty); err != nil {
 			return errgo.Newf("'%s' is invalid: %s", param, err)
 		}
 
-		name, value := parseVariable(param)
+		name, raw := parseVariable(param)
+		value, source, err := resolver.resolve(raw)
+		if err != nil {
+			return errgo.Notef(err, "invalid value for %s", name)
+		}
+		if value == "" && !opts.AllowEmpty {
+			return errgo.Newf("the value of %s is empty, use --allow-empty to set it anyway", name)
+		}
+		switch source {
+		case sourceFile:
+			descriptions[name] = fmt.Sprintf("%s has been set to the content of %s.", name, raw[1:])
+		case sourceStdin:
+			descriptions[name] = fmt.Sprintf("%s has been set to the standard input.", name)
+		case sourceGenerator:
+			descriptions[name] = fmt.Sprintf("%s has been set to a generated value.", name)
+		}
 		variables = append(variables, &scalingo.Variable{
 			Name:  name,
 			Value: value,
@@ -33,21 +62,42 @@ func Add(app string, params []string) error {
 	}
 
 	c := config.ScalingoClient()
-	_, _, err := c.VariableMultipleSet(app, variables)
+	var previous scalingo.Variables
+	if opts.RevertOnFailure {
+		var err error
+		previous, err = c.VariablesList(app)
+		if err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+	}
+
+	set, _, err := c.VariableMultipleSet(app, variables)
 	if err != nil {
 		return errgo.Mask(err, errgo.Any)
 	}
 
 	for _, variable := range variables {
+		if description, ok := descriptions[variable.Name]; ok {
+			fmt.Println(description)
+			continue
+		}
 		fmt.Printf("%s has been set to '%s'.\n", variable.Name, variable.Value)
 	}
-	fmt.Println("\nRestart your containers to apply these environment changes on your application:")
-	fmt.Printf("scalingo --app %s restart\n", app)
 
-	return nil
+	// The previous values are restored and the new variables removed if the
+	// restart fails
+	var revert Changes
+	for _, variable := range variables {
+		if p, ok := previous.Contains(variable.Name); ok {
+			revert.Changed = append(revert.Changed, &scalingo.Variable{Name: p.Name, Value: p.Value})
+		} else if v, ok := set.Contains(variable.Name); ok {
+			revert.Removed = append(revert.Removed, v)
+		}
+	}
+	return restart(app, opts.RestartOpts, revert)
 }
 
-func Delete(app string, varNames []string) error {
+func Delete(app string, varNames []string, opts DeleteOpts) error {
 	c := config.ScalingoClient()
 	vars, err := c.VariablesList(app)
 
@@ -72,18 +122,21 @@ func Delete(app string, varNames []string) error {
 		}
 		fmt.Printf("%s has been unset.\n", v.Name)
 	}
-	fmt.Println("\nRestart your containers to apply these environment changes on your application:")
-	fmt.Printf("scalingo --app %s restart\n", app)
-	return nil
+
+	var revert Changes
+	for _, v := range varsToUnset {
+		revert.Added = append(revert.Added, &scalingo.Variable{Name: v.Name, Value: v.Value})
+	}
+	return restart(app, opts.RestartOpts, revert)
 }
 
-func isEnvEditValid(edit string) error {
+func isEnvEditValid(edit string, allowEmpty bool) error {
 	if !strings.Contains(edit, "=") {
 		return setInvalidSyntaxError
 	}
 	name, value := parseVariable(edit)
 
-	if name == "" || value == "" {
+	if name == "" || (value == "" && !allowEmpty) {
 		return setInvalidSyntaxError
 	}
 
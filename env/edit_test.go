@@ -10,22 +10,27 @@ func TestDelete(t *testing.T) {
 
 func TestIsEnvEditValid(t *testing.T) {
 	v := "VAR1=VAL1"
-	if err := isEnvEditValid(v); err != nil {
+	if err := isEnvEditValid(v, false); err != nil {
 		t.Fatal(v, "should be valid, got", err)
 	}
 
 	vs := []string{"VAR1=", "=VAL1", "VAR"}
 	for _, v = range vs {
-		if err := isEnvEditValid(v); err == nil {
+		if err := isEnvEditValid(v, false); err == nil {
 			t.Fatal(v, "should not be valid")
 		} else if err != setInvalidSyntaxError {
 			t.Fatal("expected", setInvalidSyntaxError, "error, got", err)
 		}
 	}
 
+	v = "VAR1="
+	if err := isEnvEditValid(v, true); err != nil {
+		t.Fatal(v, "should be valid with empty values allowed, got", err)
+	}
+
 	vs = []string{"VA R=VAL", "	VAR=VAL", "VAR=VAL", "%%%=VAL"}
 	for _, v = range vs {
-		if err := isEnvEditValid(v); err == nil {
+		if err := isEnvEditValid(v, false); err == nil {
 			t.Fatal(v, "should not be valid")
 		} else if err != errInvalidNameFormat {
 			t.Fatal("expected", errInvalidNameFormat, "error, got", err)
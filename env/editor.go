@@ -0,0 +1,193 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/env/dotenv"
+	"github.com/Scalingo/cli/term"
+	"github.com/Scalingo/go-scalingo"
+	"gopkg.in/errgo.v1"
+)
+
+const (
+	editorErrorPrefix = "# ERROR: "
+	editorAddonSuffix = " # read-only, provided by an addon"
+)
+
+type EditOpts struct {
+	// Yes applies the changes without confirmation
+	Yes bool
+}
+
+// Edit opens the environment of the application in the editor of the user
+// and applies the modifications. The file is opened again when it can't be
+// parsed, with the error written above the faulty line.
+func Edit(app string, opts EditOpts) error {
+	if !term.IsATTY(os.Stdin) {
+		return errgo.New("env-edit needs an interactive terminal to run the editor")
+	}
+
+	c := config.ScalingoClient()
+	current, err := c.VariablesList(app)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	fd, err := ioutil.TempFile("", "scalingo-env-"+app)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	path := fd.Name()
+	fd.Close()
+	defer os.Remove(path)
+
+	wanted, modified, err := editVariables(path, editorContent(app, current))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if !modified {
+		fmt.Println("The environment has not been modified.")
+		return nil
+	}
+
+	changes := diffVariables(current, wanted, true)
+	if changes.IsEmpty() {
+		fmt.Println("The environment has not been modified.")
+		return nil
+	}
+	changes.Print(os.Stdout, false)
+
+	err = confirmChanges(app, opts.Yes)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	err = changes.apply(app)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	fmt.Println("Environment of", app, "updated.")
+	printRestartHint(app)
+	return nil
+}
+
+// editVariables opens the content in the editor until it can be parsed, the
+// file is written at path. It returns false if the content has not been
+// modified.
+func editVariables(path, original string) (scalingo.Variables, bool, error) {
+	content := original
+	var parseErr error
+	for {
+		err := ioutil.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			return nil, false, errgo.Mask(err)
+		}
+		err = runEditor(path)
+		if err != nil {
+			return nil, false, errgo.Mask(err)
+		}
+		edited, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, false, errgo.Mask(err)
+		}
+
+		previous := removeEditorErrors(content)
+		content = removeEditorErrors(string(edited))
+		if content == removeEditorErrors(original) {
+			return nil, false, nil
+		}
+		if parseErr != nil && content == previous {
+			// The file has been closed without fixing the error
+			return nil, false, errgo.Notef(parseErr, "invalid environment")
+		}
+		wanted, err := dotenv.Parse(strings.NewReader(content))
+		if err == nil {
+			return wanted, true, nil
+		}
+		dotenvErr, ok := err.(*dotenv.ParseError)
+		if !ok {
+			return nil, false, errgo.Mask(err)
+		}
+		parseErr = dotenvErr
+		content = annotateEditorError(content, dotenvErr)
+	}
+}
+
+// editorContent writes the variables in the dotenv format, the addon
+// variables are commented since they can't be modified.
+func editorContent(app string, vars scalingo.Variables) string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "# Environment of %s\n", app)
+	fmt.Fprintln(&buffer, "# Add, modify or remove variables, then save and close the file to review the changes.")
+	fmt.Fprintln(&buffer, "# Values with spaces, quotes or new lines must be double-quoted, \\n is a new line.")
+	fmt.Fprintln(&buffer)
+
+	var addonVars scalingo.Variables
+	for _, v := range sortedVariables(vars) {
+		if IsAddonVariable(v.Name) {
+			addonVars = append(addonVars, v)
+			continue
+		}
+		fmt.Fprintf(&buffer, "%s=%s\n", v.Name, dotenv.Quote(v.Value))
+	}
+
+	if len(addonVars) > 0 {
+		fmt.Fprintln(&buffer)
+		for _, v := range addonVars {
+			fmt.Fprintf(&buffer, "# %s=%s%s\n", v.Name, dotenv.Quote(v.Value), editorAddonSuffix)
+		}
+	}
+	return buffer.String()
+}
+
+// annotateEditorError writes the error above the line where it occurred
+func annotateEditorError(content string, parseErr *dotenv.ParseError) string {
+	lines := strings.Split(content, "\n")
+	i := parseErr.Line - 1
+	if i < 0 || i > len(lines) {
+		i = 0
+	}
+	annotated := append([]string{}, lines[:i]...)
+	annotated = append(annotated, editorErrorPrefix+parseErr.Msg)
+	annotated = append(annotated, lines[i:]...)
+	return strings.Join(annotated, "\n")
+}
+
+func removeEditorErrors(content string) string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(line, editorErrorPrefix) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// runEditor opens the file with $VISUAL or $EDITOR, vi by default. The
+// variables may contain arguments, like 'code --wait'.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return errgo.Notef(err, "fail to run the editor '%s'", editor)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	stdio "io"
+	"os"
+	"strings"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/env/dotenv"
+	"github.com/Scalingo/go-scalingo"
+	"gopkg.in/errgo.v1"
+)
+
+// ExportFormats are the formats accepted by Export
+var ExportFormats = []string{"dotenv", "json", "yaml", "shell"}
+
+// Export writes the environment of the application on the standard output
+// in the given format, escaped so that it can be read back.
+func Export(app, format string) error {
+	c := config.ScalingoClient()
+	vars, err := c.VariablesList(app)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	return writeVariables(os.Stdout, sortedVariables(vars), format)
+}
+
+func writeVariables(w stdio.Writer, vars scalingo.Variables, format string) error {
+	var err error
+	switch format {
+	case "dotenv":
+		err = dotenv.Write(w, vars)
+	case "json":
+		err = writeJSON(w, vars)
+	case "yaml":
+		err = writeYAML(w, vars)
+	case "shell":
+		err = writeShell(w, vars)
+	default:
+		return errgo.Newf("unknown format '%s', accepted: %s", format, strings.Join(ExportFormats, ", "))
+	}
+	return errgo.Mask(err)
+}
+
+func writeJSON(w stdio.Writer, vars scalingo.Variables) error {
+	// A map is encoded with sorted keys
+	object := map[string]string{}
+	for _, v := range vars {
+		object[v.Name] = v.Value
+	}
+	content, err := json.MarshalIndent(object, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", content)
+	return err
+}
+
+// writeYAML writes a YAML mapping, the values are JSON strings which are
+// valid double-quoted YAML scalars.
+func writeYAML(w stdio.Writer, vars scalingo.Variables) error {
+	for _, v := range vars {
+		value, err := json.Marshal(v.Value)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s: %s\n", v.Name, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeShell writes export statements to be evaluated by a POSIX shell, the
+// values are single-quoted so that nothing is expanded.
+func writeShell(w stdio.Writer, vars scalingo.Variables) error {
+	for _, v := range vars {
+		_, err := fmt.Fprintf(w, "export %s=%s\n", v.Name, shellQuote(v.Value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
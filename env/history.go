@@ -0,0 +1,135 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/go-scalingo"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/errgo.v1"
+)
+
+const historyPageSize = 100
+
+type HistoryOpts struct {
+	// Name only keeps the changes of this variable
+	Name string
+	// Since and Until limit the changes to a period, ignored if zero
+	Since time.Time
+	Until time.Time
+	// Reveal displays the values of the secrets
+	Reveal bool
+}
+
+// variableChange is a modification of a variable found in the timeline of
+// the application
+type variableChange struct {
+	At       time.Time
+	User     string
+	Name     string
+	Action   string
+	Value    string
+	OldValue string
+}
+
+// History displays the changes of the environment of the application, from
+// the most recent one. All the pages of the timeline are read, until Since.
+func History(app string, opts HistoryOpts) error {
+	c := config.ScalingoClient()
+	var changes []variableChange
+	for page := 1; ; page++ {
+		events, pagination, err := c.EventsList(app, scalingo.PaginationOpts{Page: page, PerPage: historyPageSize})
+		if err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+
+		done := false
+		for _, event := range events {
+			createdAt := event.GetEvent().CreatedAt
+			// The events are sorted from the most recent one
+			if !opts.Since.IsZero() && createdAt.Before(opts.Since) {
+				done = true
+				break
+			}
+			if !opts.Until.IsZero() && createdAt.After(opts.Until) {
+				continue
+			}
+			for _, change := range variableChanges(event) {
+				if opts.Name == "" || change.Name == opts.Name {
+					changes = append(changes, change)
+				}
+			}
+		}
+		if done || len(events) == 0 || page >= pagination.TotalPages {
+			break
+		}
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("No change of the environment found.")
+		return nil
+	}
+
+	display := func(name, value string) string {
+		if opts.Reveal {
+			return value
+		}
+		return maskValue(name, value)
+	}
+	t := tablewriter.NewWriter(os.Stdout)
+	t.SetHeader([]string{"Date", "User", "Variable", "Change"})
+	t.SetAutoWrapText(false)
+	for _, change := range changes {
+		description := change.Action
+		switch {
+		case change.Action == "removed":
+		case change.OldValue != "":
+			description = fmt.Sprintf("%s to '%s' (was '%s')", change.Action,
+				display(change.Name, change.Value), display(change.Name, change.OldValue))
+		default:
+			description = fmt.Sprintf("%s to '%s'", change.Action, display(change.Name, change.Value))
+		}
+		t.Append([]string{change.At.Local().Format("2006-01-02 15:04:05"), change.User, change.Name, description})
+	}
+	t.Render()
+	return nil
+}
+
+// variableChanges extracts the modifications of variables of an event
+func variableChanges(event scalingo.DetailedEvent) []variableChange {
+	base := variableChange{
+		At:   event.GetEvent().CreatedAt,
+		User: event.GetEvent().User.Username,
+	}
+	change := func(v scalingo.EventVariable, action, oldValue string) variableChange {
+		c := base
+		c.Name = v.Name
+		c.Action = action
+		c.Value = v.Value
+		c.OldValue = oldValue
+		return c
+	}
+
+	var changes []variableChange
+	switch e := event.(type) {
+	case *scalingo.EventNewVariableType:
+		changes = append(changes, change(e.TypeData.EventVariable, "set", ""))
+	case *scalingo.EventEditVariableType:
+		changes = append(changes, change(e.TypeData.EventVariable, "modified", e.TypeData.OldValue))
+	case *scalingo.EventEditVariablesType:
+		for _, v := range e.TypeData.NewVars {
+			changes = append(changes, change(v, "set", ""))
+		}
+		for _, v := range e.TypeData.UpdatedVars {
+			changes = append(changes, change(v, "modified", ""))
+		}
+		for _, v := range e.TypeData.DeletedVars {
+			changes = append(changes, change(v, "removed", ""))
+		}
+	case *scalingo.EventDeleteVariableType:
+		changes = append(changes, change(e.TypeData.EventVariable, "removed", ""))
+	}
+	return changes
+}
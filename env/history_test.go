@@ -0,0 +1,32 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/Scalingo/go-scalingo"
+)
+
+func TestVariableChanges(t *testing.T) {
+	event := &scalingo.EventEditVariablesType{
+		Event: scalingo.Event{User: scalingo.EventUser{Username: "john"}},
+		TypeData: scalingo.EventEditVariablesTypeData{
+			NewVars:     scalingo.EventVariables{{Name: "A", Value: "1"}},
+			UpdatedVars: scalingo.EventVariables{{Name: "B", Value: "2"}},
+			DeletedVars: scalingo.EventVariables{{Name: "C"}},
+		},
+	}
+	changes := variableChanges(event)
+	if len(changes) != 3 {
+		t.Fatal("expected 3 changes, got", len(changes))
+	}
+	expected := []struct{ name, action string }{{"A", "set"}, {"B", "modified"}, {"C", "removed"}}
+	for i, e := range expected {
+		if changes[i].Name != e.name || changes[i].Action != e.action || changes[i].User != "john" {
+			t.Fatalf("unexpected change %d: %+v", i, changes[i])
+		}
+	}
+
+	if changes := variableChanges(&scalingo.EventRestartType{}); len(changes) != 0 {
+		t.Fatal("expected no change for a restart event, got", changes)
+	}
+}
@@ -0,0 +1,98 @@
+package env
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/env/dotenv"
+	"github.com/Scalingo/go-scalingo"
+	"gopkg.in/errgo.v1"
+)
+
+type ImportOpts struct {
+	// Prune removes the variables missing from the file
+	Prune bool
+	// DryRun only displays the changes
+	DryRun bool
+	// Yes applies the changes without confirmation
+	Yes bool
+}
+
+// Import sets the variables of a dotenv or JSON file, '-' reads from the
+// standard input. The changes are previewed before being applied.
+func Import(app, path string, opts ImportOpts) error {
+	wanted, err := readVariablesFile(path)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return syncVariables(app, wanted, opts)
+}
+
+// syncVariables displays the changes needed to set the wanted variables, and
+// applies them once confirmed
+func syncVariables(app string, wanted scalingo.Variables, opts ImportOpts) error {
+	c := config.ScalingoClient()
+	current, err := c.VariablesList(app)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	changes := diffVariables(current, wanted, opts.Prune)
+	changes.Print(os.Stdout, false)
+	if changes.IsEmpty() || opts.DryRun {
+		return nil
+	}
+
+	err = confirmChanges(app, opts.Yes)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	err = changes.apply(app)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	fmt.Println("Environment of", app, "updated.")
+	printRestartHint(app)
+	return nil
+}
+
+// readVariablesFile parses a JSON object of strings or a dotenv file
+func readVariablesFile(path string) (scalingo.Variables, error) {
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to read %s", path)
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		vars, err := dotenv.Parse(bytes.NewReader(content))
+		if err != nil {
+			return nil, errgo.Notef(err, "invalid env file %s", path)
+		}
+		return vars, nil
+	}
+
+	var object map[string]string
+	err = json.Unmarshal(content, &object)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid JSON file %s, an object of strings is expected", path)
+	}
+	var vars scalingo.Variables
+	for name, value := range object {
+		if !nameFormat.MatchString(name) {
+			return nil, errgo.Newf("invalid JSON file %s: %s", path, errInvalidNameFormat)
+		}
+		vars = append(vars, &scalingo.Variable{Name: name, Value: value})
+	}
+	return sortedVariables(vars), nil
+}
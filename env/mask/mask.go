@@ -0,0 +1,97 @@
+package mask
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+const hidden = "********"
+
+var (
+	// DefaultPatterns are the patterns of the variable names considered as
+	// secrets, they are matched against the uppercased name of the variable.
+	DefaultPatterns = []string{
+		"*_KEY", "*_SECRET", "*_TOKEN", "*_PASSWORD",
+		"SECRET_*", "*_SECRET_*", "PASSWORD", "SECRET", "TOKEN",
+	}
+)
+
+// Patterns returns the default patterns completed with the comma-separated
+// list of additional patterns, configured with SCALINGO_SECRET_PATTERNS.
+func Patterns(additional string) []string {
+	patterns := append([]string{}, DefaultPatterns...)
+	for _, pattern := range strings.Split(additional, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// IsSecret returns true if the variable name matches one of the patterns or
+// if its value is an URL embedding a password.
+func IsSecret(patterns []string, name, value string) bool {
+	upperName := strings.ToUpper(name)
+	for _, pattern := range patterns {
+		ok, err := path.Match(strings.ToUpper(pattern), upperName)
+		if err == nil && ok {
+			return true
+		}
+	}
+	return hasURLCredentials(value)
+}
+
+// Variable returns the value to display for the given variable: the value
+// itself if it's not considered as a secret, a masked version otherwise.
+func Variable(patterns []string, name, value string) string {
+	if !IsSecret(patterns, name, value) {
+		return value
+	}
+	if hasURLCredentials(value) {
+		return URL(value)
+	}
+	return Value(value)
+}
+
+// Value masks a secret value, only the first and the last characters are
+// kept if the value is long enough for it to not disclose the secret.
+func Value(value string) string {
+	runes := []rune(value)
+	if len(runes) < 12 {
+		return hidden
+	}
+	return string(runes[0]) + hidden + string(runes[len(runes)-1])
+}
+
+// URL masks the password contained in the given URL, the rest of the URL is
+// kept to help identifying the resource.
+func URL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return Value(value)
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	u.User = url.User(u.User.Username())
+	masked := u.String()
+	userPart := u.Scheme + "://" + u.User.String()
+	if !strings.HasPrefix(masked, userPart) {
+		return Value(value)
+	}
+	return userPart + ":" + hidden + masked[len(userPart):]
+}
+
+func hasURLCredentials(value string) bool {
+	if !strings.Contains(value, "://") {
+		return false
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return false
+	}
+	_, ok := u.User.Password()
+	return ok
+}
@@ -0,0 +1,47 @@
+package env
+
+import (
+	"fmt"
+
+	"github.com/Scalingo/cli/apps"
+	"github.com/Scalingo/cli/io"
+	"gopkg.in/errgo.v1"
+)
+
+// RestartOpts restarts the application once its environment is modified
+type RestartOpts struct {
+	Restart bool
+	// Scope are the container types or names to restart, all the containers
+	// are restarted if it is empty
+	Scope []string
+	// RevertOnFailure restores the previous environment if the restart fails
+	RevertOnFailure bool
+}
+
+// restart applies the environment changes by restarting the application and
+// waiting for the end of the operation. The revert changes are applied if it
+// fails and opts.RevertOnFailure is true.
+func restart(app string, opts RestartOpts, revert Changes) error {
+	if !opts.Restart {
+		printRestartHint(app)
+		return nil
+	}
+
+	fmt.Println()
+	err := apps.Restart(app, true, opts.Scope)
+	if err == nil {
+		return nil
+	}
+
+	if !opts.RevertOnFailure {
+		return errgo.Notef(err, "the environment has been modified but the restart failed, "+
+			"the running containers may still use the previous environment")
+	}
+
+	io.Warning("The restart failed, restoring the previous environment")
+	revertErr := revert.apply(app)
+	if revertErr != nil {
+		return errgo.Notef(revertErr, "the restart failed (%v) and the previous environment could not be restored", err)
+	}
+	return errgo.Notef(err, "the restart failed, the previous environment has been restored")
+}
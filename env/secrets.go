@@ -0,0 +1,306 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/env/dotenv"
+	"github.com/Scalingo/cli/env/secrets"
+	"github.com/Scalingo/cli/term"
+	"github.com/Scalingo/go-scalingo"
+	"gopkg.in/errgo.v1"
+)
+
+const secretsKeyFile = "secrets_key"
+
+type SecretsPushOpts struct {
+	// DryRun only displays the changes
+	DryRun bool
+	// Yes applies the changes without confirmation
+	Yes bool
+}
+
+// SecretsKeygen generates the key pair of the user, the private key is
+// written in the configuration directory
+func SecretsKeygen() error {
+	path := filepath.Join(config.C.ConfigDir, secretsKeyFile)
+	if _, err := os.Stat(path); err == nil {
+		return errgo.Newf("a private key already exists in %s", path)
+	}
+
+	private, err := secrets.GenerateKey()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	err = ioutil.WriteFile(path, []byte(private.String()+"\n"), 0600)
+	if err != nil {
+		return errgo.Notef(err, "fail to write the private key")
+	}
+
+	fmt.Printf("Your private key has been written in %s, keep it safe.\n", path)
+	fmt.Println("Add your public key to the recipients of the secrets files:")
+	fmt.Println(private.PublicKey())
+	return nil
+}
+
+// SecretsEncrypt encrypts the variable name in the secrets file, its value is
+// typed or read from the standard input. Without name, all the secrets are
+// encrypted again with a new key, shared with the current recipients only.
+func SecretsEncrypt(path, name string) error {
+	private, err := secretsPrivateKey()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	file, err := readSecretsFile(path, private, name != "")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	if name == "" {
+		err = file.Rekey(private)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		err = file.WriteFile(path)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		fmt.Printf("The secrets of %s have been encrypted for %d recipient(s).\n", path, len(file.Recipients))
+		return nil
+	}
+
+	if !nameFormat.MatchString(name) {
+		return errgo.Newf("'%s' is invalid: %s", name, errInvalidNameFormat)
+	}
+	value, err := readSecretValue(name)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	values, err := file.Decrypt(private)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	values.Set(name, value)
+	err = file.Update(private, values)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	err = file.WriteFile(path)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	fmt.Printf("%s has been encrypted in %s.\n", name, path)
+	return nil
+}
+
+// SecretsDecrypt displays the value of the variable name, or all the secrets
+// in the dotenv format. Nothing is written on the disk.
+func SecretsDecrypt(path, name string) error {
+	values, err := decryptSecretsFile(path)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if name == "" {
+		return dotenv.Write(os.Stdout, secretsVariables(values))
+	}
+	value, ok := values.Get(name)
+	if !ok {
+		return errgo.Newf("%s is not in %s", name, path)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// SecretsEdit opens the secrets in clear in the editor of the user. The
+// temporary file is created in a memory-backed directory, so that the
+// secrets are not written on the disk.
+func SecretsEdit(path string) error {
+	if !term.IsATTY(os.Stdin) {
+		return errgo.New("secrets-edit needs an interactive terminal to run the editor")
+	}
+	private, err := secretsPrivateKey()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	file, err := readSecretsFile(path, private, true)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	values, err := file.Decrypt(private)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	dir, err := memoryTempDir()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	fd, err := ioutil.TempFile(dir, "scalingo-secrets-")
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	tmpPath := fd.Name()
+	fd.Close()
+	defer shredFile(tmpPath)
+
+	current := secretsVariables(values)
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "# Secrets of %s, they are encrypted once the file is saved and closed.\n", path)
+	fmt.Fprintln(&content, "# Values with spaces, quotes or new lines must be double-quoted, \\n is a new line.")
+	fmt.Fprintln(&content)
+	dotenv.Write(&content, current)
+
+	wanted, modified, err := editVariables(tmpPath, content.String())
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	changes := diffVariables(current, wanted, true)
+	if !modified || changes.IsEmpty() {
+		fmt.Println("The secrets have not been modified.")
+		return nil
+	}
+	changes.Print(os.Stdout, false)
+
+	var edited secrets.Entries
+	for _, v := range wanted {
+		edited.Set(v.Name, v.Value)
+	}
+	err = file.Update(private, edited)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	err = file.WriteFile(path)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	fmt.Println("The secrets have been encrypted in", path)
+	return nil
+}
+
+// SecretsPush decrypts the secrets in memory and sets them in the
+// environment of the application, the changes are displayed first
+func SecretsPush(app, path string, opts SecretsPushOpts) error {
+	values, err := decryptSecretsFile(path)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	return syncVariables(app, secretsVariables(values), ImportOpts{
+		DryRun: opts.DryRun,
+		Yes:    opts.Yes,
+	})
+}
+
+// secretsPrivateKey reads the private key from SCALINGO_SECRETS_KEY, or from
+// the file written by SecretsKeygen
+func secretsPrivateKey() (secrets.Key, error) {
+	encoded := config.C.ScalingoSecretsKey
+	if encoded == "" {
+		path := filepath.Join(config.C.ConfigDir, secretsKeyFile)
+		content, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return secrets.Key{}, errgo.New("no private key, generate one with 'scalingo secrets-keygen' or set SCALINGO_SECRETS_KEY")
+		}
+		if err != nil {
+			return secrets.Key{}, errgo.Notef(err, "fail to read the private key")
+		}
+		encoded = string(content)
+	}
+	key, err := secrets.ParseKey(encoded)
+	if err != nil {
+		return key, errgo.Notef(err, "invalid private key")
+	}
+	return key, nil
+}
+
+// readSecretsFile reads the secrets file, if create is true a missing file is
+// initialized with the public key of the user as the only recipient
+func readSecretsFile(path string, private secrets.Key, create bool) (*secrets.File, error) {
+	file, err := secrets.ReadFile(path)
+	if err == nil {
+		return file, nil
+	}
+	if !create || !os.IsNotExist(errgo.Cause(err)) {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+
+	name := os.Getenv("USER")
+	if config.AuthenticatedUser != nil {
+		name = config.AuthenticatedUser.Username
+	}
+	if name == "" {
+		name = "me"
+	}
+	fmt.Printf("Creating %s, your public key is its first recipient.\n", path)
+	return &secrets.File{
+		Recipients: secrets.Entries{{Name: name, Value: private.PublicKey().String()}},
+	}, nil
+}
+
+func decryptSecretsFile(path string) (secrets.Entries, error) {
+	private, err := secretsPrivateKey()
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	file, err := secrets.ReadFile(path)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return file.Decrypt(private)
+}
+
+// readSecretValue asks the value without echoing it, or reads it from the
+// standard input in non-interactive mode
+func readSecretValue(name string) (string, error) {
+	var value string
+	if !config.C.DisableInteractive && term.IsATTY(os.Stdin) {
+		password, err := term.Password(fmt.Sprintf("Value of %s: ", name))
+		if err != nil {
+			return "", errgo.Mask(err)
+		}
+		value = password
+	} else {
+		content, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return "", errgo.Notef(err, "fail to read the standard input")
+		}
+		value = trimFinalNewline(string(content))
+	}
+	if value == "" {
+		return "", errgo.Newf("the value of %s is empty", name)
+	}
+	return value, nil
+}
+
+func secretsVariables(values secrets.Entries) scalingo.Variables {
+	vars := make(scalingo.Variables, 0, len(values))
+	for _, v := range values {
+		vars = append(vars, &scalingo.Variable{Name: v.Name, Value: v.Value})
+	}
+	return vars
+}
+
+// memoryTempDir returns a directory stored in memory (tmpfs)
+func memoryTempDir() (string, error) {
+	for _, dir := range []string{"/dev/shm", os.Getenv("XDG_RUNTIME_DIR")} {
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", errgo.New("no memory-backed directory (/dev/shm or $XDG_RUNTIME_DIR) to edit the secrets " +
+		"without writing them on the disk, use 'scalingo secrets-encrypt NAME' instead")
+}
+
+// shredFile overwrites the content of the file before removing it
+func shredFile(path string) {
+	if info, err := os.Stat(path); err == nil {
+		ioutil.WriteFile(path, make([]byte, info.Size()), 0600)
+	}
+	os.Remove(path)
+}
@@ -0,0 +1,330 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"gopkg.in/errgo.v1"
+)
+
+// The data key of a file is encrypted for each recipient with a NaCl sealed
+// box, the secrets are encrypted with the data key using AES-256-GCM.
+const (
+	keySize   = 32
+	nonceSize = 12
+
+	encryptedPrefix = "ENC[v1,"
+	encryptedSuffix = "]"
+	// keySeparator separates the public key of the recipient from the data
+	// key encrypted for it in the keys section
+	keySeparator = ","
+)
+
+// Key is an X25519 public or private key
+type Key [keySize]byte
+
+// String encodes the key in base64, the format used in the secrets file
+func (k Key) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+// ParseKey decodes a base64 encoded key
+func ParseKey(s string) (Key, error) {
+	var key Key
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(raw) != keySize {
+		return key, errgo.New("invalid key, 32 bytes encoded in base64 are expected")
+	}
+	copy(key[:], raw)
+	return key, nil
+}
+
+// GenerateKey returns a new private key
+func GenerateKey() (Key, error) {
+	var private Key
+	_, err := rand.Read(private[:])
+	if err != nil {
+		return private, errgo.Notef(err, "fail to generate a key")
+	}
+	return private, nil
+}
+
+// PublicKey returns the public key matching the private key
+func (k Key) PublicKey() Key {
+	var public Key
+	curve25519.ScalarBaseMult((*[keySize]byte)(&public), (*[keySize]byte)(&k))
+	return public
+}
+
+// newDataKey generates the key used to encrypt the secrets of a file
+func newDataKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to generate a key")
+	}
+	return key, nil
+}
+
+// wrapKey encrypts the data key for a recipient. The public key of the
+// recipient is kept next to the sealed box, encoded in base64, to detect a
+// recipient whose key has been replaced.
+func wrapKey(dataKey []byte, recipient Key) (string, error) {
+	sealed, err := box.SealAnonymous(nil, dataKey, (*[keySize]byte)(&recipient), rand.Reader)
+	if err != nil {
+		return "", errgo.Notef(err, "fail to encrypt the key of the file")
+	}
+	return recipient.String() + keySeparator + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// wrappedFor returns the public key for which the data key has been wrapped
+func wrappedFor(wrapped string) (Key, error) {
+	i := strings.Index(wrapped, keySeparator)
+	if i == -1 {
+		return Key{}, errgo.New("invalid encrypted key")
+	}
+	return ParseKey(wrapped[:i])
+}
+
+// unwrapKey decrypts the data key encrypted for the owner of the private key
+func unwrapKey(wrapped string, private Key) ([]byte, error) {
+	i := strings.Index(wrapped, keySeparator)
+	if i == -1 {
+		return nil, errgo.New("invalid encrypted key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(wrapped[i+len(keySeparator):])
+	if err != nil {
+		return nil, errgo.New("invalid encrypted key")
+	}
+	public := private.PublicKey()
+	dataKey, ok := box.OpenAnonymous(nil, raw, (*[keySize]byte)(&public), (*[keySize]byte)(&private))
+	if !ok {
+		return nil, errgo.New("fail to decrypt the key of the file, it has not been encrypted for this private key")
+	}
+	return dataKey, nil
+}
+
+// encryptValue encrypts the value of the variable, the name is authenticated
+// so that encrypted values can't be swapped between variables
+func encryptValue(dataKey []byte, name, value string) (string, error) {
+	sealed, err := seal(dataKey, []byte(value), []byte(name))
+	if err != nil {
+		return "", errgo.Mask(err)
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + encryptedSuffix, nil
+}
+
+func decryptValue(dataKey []byte, name, encrypted string) (string, error) {
+	if !IsEncrypted(encrypted) {
+		return "", errgo.Newf("the value of %s is not encrypted", name)
+	}
+	encoded := strings.TrimSuffix(strings.TrimPrefix(encrypted, encryptedPrefix), encryptedSuffix)
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errgo.Newf("the encrypted value of %s is invalid", name)
+	}
+	value, err := open(dataKey, raw, []byte(name))
+	if err != nil {
+		return "", errgo.Newf("fail to decrypt %s, the value has been modified or encrypted with another key", name)
+	}
+	return string(value), nil
+}
+
+// IsEncrypted returns true if the value has been encrypted by encryptValue
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix) && strings.HasSuffix(value, encryptedSuffix)
+}
+
+// seal encrypts with AES-256-GCM, the random nonce is prepended
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	nonce := make([]byte, nonceSize)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to generate a nonce")
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	if len(sealed) < nonceSize {
+		return nil, errgo.New("invalid encrypted data")
+	}
+	return aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Decrypt returns the secrets in clear, the private key must be the one of a
+// recipient of the file
+func (f *File) Decrypt(private Key) (Entries, error) {
+	if len(f.Secrets) == 0 {
+		return nil, nil
+	}
+	dataKey, err := f.dataKey(private)
+	if err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return f.decrypt(dataKey)
+}
+
+// Update replaces the secrets of the file, the values which are not modified
+// keep their encrypted form. The data key is generated for a new file and is
+// encrypted for the recipients which don't have it yet. If a recipient has
+// been removed or its public key replaced, the old key still opens the data
+// key: a new one is generated and all the secrets are encrypted again.
+func (f *File) Update(private Key, secrets Entries) error {
+	var dataKey []byte
+	var current Entries
+	var err error
+	if len(f.Keys) == 0 {
+		if len(f.Secrets) > 0 {
+			return errgo.New("the file contains secrets but no keys to decrypt them")
+		}
+		dataKey, err = newDataKey()
+	} else {
+		dataKey, err = f.dataKey(private)
+		if err == nil {
+			current, err = f.decrypt(dataKey)
+		}
+		if err == nil && f.hasStaleKeys() {
+			current = nil
+			f.Keys = nil
+			dataKey, err = newDataKey()
+		}
+	}
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	var encrypted Entries
+	for _, secret := range secrets {
+		value, ok := current.Get(secret.Name)
+		if ok && value == secret.Value {
+			previous, _ := f.Secrets.Get(secret.Name)
+			encrypted.Set(secret.Name, previous)
+			continue
+		}
+		value, err := encryptValue(dataKey, secret.Name, secret.Value)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		encrypted.Set(secret.Name, value)
+	}
+	f.Secrets = encrypted
+	return f.shareKey(dataKey)
+}
+
+// Rekey encrypts all the secrets with a new data key, shared with the current
+// recipients only. Update does it when a recipient has been removed or its
+// public key replaced.
+func (f *File) Rekey(private Key) error {
+	secrets, err := f.Decrypt(private)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	f.Keys = nil
+	f.Secrets = nil
+	return f.Update(private, secrets)
+}
+
+// dataKey finds the data key encrypted for the public key matching private
+func (f *File) dataKey(private Key) ([]byte, error) {
+	public := private.PublicKey().String()
+	for _, recipient := range f.Recipients {
+		if strings.TrimSpace(recipient.Value) != public {
+			continue
+		}
+		wrapped, ok := f.Keys.Get(recipient.Name)
+		if !ok || !f.isWrappedForRecipient(recipient.Name, wrapped) {
+			return nil, errgo.Newf("the key of the file has not been encrypted for %s yet, "+
+				"another recipient has to run 'scalingo secrets-encrypt'", recipient.Name)
+		}
+		return unwrapKey(wrapped, private)
+	}
+	return nil, errgo.Newf("the public key %s is not a recipient of the file", public)
+}
+
+// hasStaleKeys returns true if the data key has been encrypted for a
+// recipient which is no longer in the file, or for a public key which is no
+// longer the one of the recipient
+func (f *File) hasStaleKeys() bool {
+	for _, key := range f.Keys {
+		if !f.isWrappedForRecipient(key.Name, key.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWrappedForRecipient returns true if wrapped has been encrypted for the
+// current public key of the recipient named name
+func (f *File) isWrappedForRecipient(name, wrapped string) bool {
+	value, ok := f.Recipients.Get(name)
+	if !ok {
+		return false
+	}
+	public, err := ParseKey(value)
+	if err != nil {
+		return false
+	}
+	wrappedPublic, err := wrappedFor(wrapped)
+	return err == nil && wrappedPublic == public
+}
+
+func (f *File) decrypt(dataKey []byte) (Entries, error) {
+	var secrets Entries
+	for _, secret := range f.Secrets {
+		value, err := decryptValue(dataKey, secret.Name, secret.Value)
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		secrets.Set(secret.Name, value)
+	}
+	return secrets, nil
+}
+
+// shareKey encrypts the data key for the recipients which don't have it for
+// their current public key, the keys of the recipients removed from the file
+// are deleted
+func (f *File) shareKey(dataKey []byte) error {
+	if len(f.Recipients) == 0 {
+		return errgo.New("the file has no recipients")
+	}
+	var keys Entries
+	for _, recipient := range f.Recipients {
+		if wrapped, ok := f.Keys.Get(recipient.Name); ok && f.isWrappedForRecipient(recipient.Name, wrapped) {
+			keys.Set(recipient.Name, wrapped)
+			continue
+		}
+		public, err := ParseKey(recipient.Value)
+		if err != nil {
+			return errgo.Notef(err, "invalid public key for the recipient %s", recipient.Name)
+		}
+		wrapped, err := wrapKey(dataKey, public)
+		if err != nil {
+			return errgo.Mask(err)
+		}
+		keys.Set(recipient.Name, wrapped)
+	}
+	f.Keys = keys
+	return nil
+}
@@ -0,0 +1,178 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+// DefaultFile is the file where the secrets are stored, next to the code of
+// the application
+const DefaultFile = "scalingo.secrets.yml"
+
+const fileHeader = `# Secrets encrypted with the 'scalingo secrets-*' commands, they can be decrypted
+# by the recipients listed below. Add a recipient with its public key, then run
+# 'scalingo secrets-encrypt' to give it access.
+`
+
+// Entry is a 'name: value' line of a section of the file
+type Entry struct {
+	Name  string
+	Value string
+}
+
+type Entries []Entry
+
+// Get returns the value of the entry named name
+func (entries Entries) Get(name string) (string, bool) {
+	for _, e := range entries {
+		if e.Name == name {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set modifies the entry named name or adds it at the end
+func (entries *Entries) Set(name, value string) {
+	for i, e := range *entries {
+		if e.Name == name {
+			(*entries)[i].Value = value
+			return
+		}
+	}
+	*entries = append(*entries, Entry{Name: name, Value: value})
+}
+
+// File is the content of a secrets file, a YAML document with three mappings:
+//
+//	recipients: the public keys allowed to decrypt the secrets, by name
+//	keys:       the data key of the file, encrypted for each recipient
+//	secrets:    the variables, encrypted with the data key
+//
+// Only this subset of YAML is supported.
+type File struct {
+	Recipients Entries
+	Keys       Entries
+	Secrets    Entries
+}
+
+// ReadFile reads and parses the secrets file located at path
+func ReadFile(path string) (*File, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	defer fd.Close()
+
+	file, err := Parse(fd)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid secrets file %s", path)
+	}
+	return file, nil
+}
+
+// Parse reads the content of a secrets file
+func Parse(r io.Reader) (*File, error) {
+	file := &File{}
+	var section *Entries
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+
+		if line == trimmed {
+			switch line {
+			case "recipients:":
+				section = &file.Recipients
+			case "keys:":
+				section = &file.Keys
+			case "secrets:":
+				section = &file.Secrets
+			default:
+				return nil, errgo.Newf("line %d: unknown section '%s', expected recipients, keys or secrets", n, line)
+			}
+			continue
+		}
+
+		if section == nil {
+			return nil, errgo.Newf("line %d: entry outside of a section", n)
+		}
+		i := strings.Index(trimmed, ":")
+		if i <= 0 {
+			return nil, errgo.Newf("line %d: 'name: value' expected", n)
+		}
+		name := strings.TrimSpace(trimmed[:i])
+		value := strings.TrimSpace(trimmed[i+1:])
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, errgo.Newf("line %d: invalid quoted value", n)
+			}
+			value = unquoted
+		}
+		if _, ok := section.Get(name); ok {
+			return nil, errgo.Newf("line %d: %s is defined twice", n, name)
+		}
+		section.Set(name, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errgo.Mask(err)
+	}
+	return file, nil
+}
+
+// WriteFile writes the file at path, the file is replaced atomically
+func (f *File) WriteFile(path string) error {
+	var buffer bytes.Buffer
+	f.Write(&buffer)
+
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, buffer.Bytes(), 0644)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return errgo.Mask(err)
+	}
+	return nil
+}
+
+func (f *File) Write(w io.Writer) {
+	fmt.Fprint(w, fileHeader)
+	sections := []struct {
+		name    string
+		entries Entries
+	}{
+		{"recipients", f.Recipients},
+		{"keys", f.Keys},
+		{"secrets", f.Secrets},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(w, "%s:\n", section.name)
+		for _, e := range section.entries {
+			fmt.Fprintf(w, "  %s: %s\n", e.Name, quote(e.Value))
+		}
+	}
+}
+
+// quote returns the value as a YAML scalar, the keys and the encrypted values
+// are written as is
+func quote(value string) string {
+	if value == "" || strings.ContainsAny(value, "#:\"'\\ \t\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
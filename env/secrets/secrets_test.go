@@ -0,0 +1,189 @@
+package secrets
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func newTestFile(t *testing.T, names ...string) (*File, []Key) {
+	file := &File{}
+	var keys []Key
+	for _, name := range names {
+		private, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, private)
+		file.Recipients.Set(name, private.PublicKey().String())
+	}
+	return file, keys
+}
+
+func TestFileEncryptDecrypt(t *testing.T) {
+	file, keys := newTestFile(t, "alice", "bob")
+	outsider, _ := GenerateKey()
+
+	values := Entries{{Name: "STRIPE_KEY", Value: "sk_live_123"}, {Name: "PEM", Value: "-----BEGIN-----\nabc: #\n"}}
+	err := file.Update(keys[0], values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range file.Secrets {
+		if !IsEncrypted(secret.Value) || strings.Contains(secret.Value, "sk_live") {
+			t.Fatal("the secrets should be encrypted, got", secret.Value)
+		}
+	}
+
+	// Written and read back, decrypted by both recipients
+	var buffer bytes.Buffer
+	file.Write(&buffer)
+	read, err := Parse(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		decrypted, err := read.Decrypt(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range values {
+			if value, _ := decrypted.Get(v.Name); value != v.Value {
+				t.Fatalf("expected %q for %s, got %q", v.Value, v.Name, value)
+			}
+		}
+	}
+	if _, err := read.Decrypt(outsider); err == nil {
+		t.Fatal("a key which is not a recipient should not decrypt the file")
+	}
+
+	// The encrypted values can't be swapped between variables
+	stripe, _ := read.Secrets.Get("STRIPE_KEY")
+	read.Secrets.Set("PEM", stripe)
+	if _, err := read.Decrypt(keys[1]); err == nil {
+		t.Fatal("a value moved to another variable should not be decrypted")
+	}
+}
+
+func TestFileUpdateAndRekey(t *testing.T) {
+	file, keys := newTestFile(t, "alice")
+	err := file.Update(keys[0], Entries{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedA, _ := file.Secrets.Get("A")
+
+	// A new recipient gets the key, the unmodified values are kept as is
+	bob, _ := GenerateKey()
+	file.Recipients.Set("bob", bob.PublicKey().String())
+	err = file.Update(keys[0], Entries{{Name: "A", Value: "1"}, {Name: "B", Value: "3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := file.Secrets.Get("A"); value != encryptedA {
+		t.Fatal("the unmodified value should not be encrypted again")
+	}
+	decrypted, err := file.Decrypt(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := decrypted.Get("B"); value != "3" {
+		t.Fatal("expected 3, got", value)
+	}
+
+	// Once alice is removed, rekeying prevents her from decrypting the file
+	file.Recipients = file.Recipients[1:]
+	err = file.Rekey(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Keys) != 1 {
+		t.Fatal("expected a single key, got", len(file.Keys))
+	}
+	if _, err := file.Decrypt(keys[0]); err == nil {
+		t.Fatal("a removed recipient should not decrypt the file")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	contents := []string{
+		"unknown:\n  A: 1\n",
+		"  A: 1\n",
+		"secrets:\n  A 1\n",
+		"secrets:\n  A: 1\n  A: 2\n",
+		"secrets:\n  A: \"unterminated\n",
+	}
+	for _, content := range contents {
+		if _, err := Parse(strings.NewReader(content)); err == nil {
+			t.Fatalf("%q should be invalid", content)
+		}
+	}
+}
+
+func TestFileUpdateAfterRecipientRemoval(t *testing.T) {
+	file, keys := newTestFile(t, "alice", "bob")
+	err := file.Update(keys[0], Entries{{Name: "A", Value: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceDataKey, err := file.dataKey(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alice knows the data key, the next update must replace it
+	file.Recipients = file.Recipients[1:]
+	err = file.Update(keys[1], Entries{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Keys) != 1 {
+		t.Fatal("expected a single key, got", len(file.Keys))
+	}
+	if _, err := file.decrypt(aliceDataKey); err == nil {
+		t.Fatal("the previous data key should not decrypt the secrets")
+	}
+	decrypted, err := file.Decrypt(keys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := decrypted.Get("A"); value != "1" {
+		t.Fatal("expected 1, got", value)
+	}
+}
+
+func TestFileUpdateAfterRecipientKeyChange(t *testing.T) {
+	file, keys := newTestFile(t, "alice", "bob")
+	err := file.Update(keys[0], Entries{{Name: "A", Value: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobDataKey, err := file.dataKey(keys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bob's key is replaced under the same name, the old key must be useless
+	newBob, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Recipients.Set("bob", newBob.PublicKey().String())
+	if _, err := file.Decrypt(newBob); err == nil {
+		t.Fatal("the new key should not decrypt the file before it is shared")
+	}
+	err = file.Update(keys[0], Entries{{Name: "A", Value: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.decrypt(bobDataKey); err == nil {
+		t.Fatal("the previous data key should not decrypt the secrets")
+	}
+	decrypted, err := file.Decrypt(newBob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := decrypted.Get("A"); value != "1" {
+		t.Fatal("expected 1, got", value)
+	}
+}
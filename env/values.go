@@ -0,0 +1,121 @@
+package env
+
+import (
+	"crypto/rand"
+	"fmt"
+	stdio "io"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/errgo.v1"
+)
+
+const (
+	randomAlphabet  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	randomMaxLength = 4096
+)
+
+var generatorFormat = regexp.MustCompile(`^\$\(([a-z]+)(?::([0-9]+))?\)$`)
+
+// valueSource describes where the value of a variable comes from
+type valueSource int
+
+const (
+	sourceLiteral valueSource = iota
+	sourceFile
+	sourceStdin
+	sourceGenerator
+)
+
+// valueResolver computes the values given to env-set: 'NAME=@path' reads the
+// file, 'NAME=-' reads the standard input, '$(random:N)' and '$(uuid)'
+// generate a value. A value starting with '@@' is used as is, without its
+// first '@'. Other values are used as is.
+type valueResolver struct {
+	stdin     stdio.Reader
+	stdinRead bool
+}
+
+func (r *valueResolver) resolve(value string) (string, valueSource, error) {
+	switch {
+	case value == "-":
+		if r.stdinRead {
+			return "", sourceStdin, errgo.New("the standard input can only be read for one variable")
+		}
+		r.stdinRead = true
+		content, err := ioutil.ReadAll(r.stdin)
+		if err != nil {
+			return "", sourceStdin, errgo.Notef(err, "fail to read the standard input")
+		}
+		return trimFinalNewline(string(content)), sourceStdin, nil
+	case strings.HasPrefix(value, "@@"):
+		return value[1:], sourceLiteral, nil
+	case strings.HasPrefix(value, "@"):
+		content, err := ioutil.ReadFile(value[1:])
+		if err != nil {
+			return "", sourceFile, errgo.Notef(err, "fail to read the file %s", value[1:])
+		}
+		return trimFinalNewline(string(content)), sourceFile, nil
+	case generatorFormat.MatchString(value):
+		generated, err := generateValue(value)
+		return generated, sourceGenerator, err
+	}
+	return value, sourceLiteral, nil
+}
+
+func generateValue(generator string) (string, error) {
+	matches := generatorFormat.FindStringSubmatch(generator)
+	name, arg := matches[1], matches[2]
+	switch name {
+	case "random":
+		length := 64
+		if arg != "" {
+			length, _ = strconv.Atoi(arg)
+		}
+		if length < 1 || length > randomMaxLength {
+			return "", errgo.Newf("the length of a random value must be between 1 and %d", randomMaxLength)
+		}
+		return randomString(length)
+	case "uuid":
+		if arg != "" {
+			return "", errgo.New("$(uuid) doesn't take any argument")
+		}
+		return uuid()
+	}
+	return "", errgo.Newf("unknown generator $(%s), available: $(random:N), $(uuid)", name)
+}
+
+func randomString(length int) (string, error) {
+	max := big.NewInt(int64(len(randomAlphabet)))
+	res := make([]byte, length)
+	for i := range res {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errgo.Notef(err, "fail to generate a random value")
+		}
+		res[i] = randomAlphabet[n.Int64()]
+	}
+	return string(res), nil
+}
+
+// uuid generates a random UUID (version 4)
+func uuid() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errgo.Notef(err, "fail to generate a random value")
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// trimFinalNewline removes the newline ending most files, like $(cat file)
+// would do
+func trimFinalNewline(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
@@ -0,0 +1,73 @@
+package env
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestValueResolver(t *testing.T) {
+	fd, err := ioutil.TempFile("", "scalingo-env-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fd.Name())
+	fd.WriteString("-----BEGIN KEY-----\nabc\n-----END KEY-----\n")
+	fd.Close()
+
+	r := &valueResolver{stdin: strings.NewReader("from stdin\n")}
+	value, source, err := r.resolve("@" + fd.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != sourceFile || value != "-----BEGIN KEY-----\nabc\n-----END KEY-----" {
+		t.Fatal("unexpected value from the file:", value)
+	}
+
+	value, source, err = r.resolve("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != sourceStdin || value != "from stdin" {
+		t.Fatal("unexpected value from stdin:", value)
+	}
+	if _, _, err = r.resolve("-"); err == nil {
+		t.Fatal("stdin should only be read once")
+	}
+
+	value, source, err = r.resolve("VAL1")
+	if err != nil || source != sourceLiteral || value != "VAL1" {
+		t.Fatal("literal values should be kept, got", value, err)
+	}
+
+	value, source, err = r.resolve("@@" + fd.Name())
+	if err != nil || source != sourceLiteral || value != "@"+fd.Name() {
+		t.Fatal("'@@' should escape a literal '@', got", value, err)
+	}
+}
+
+func TestGenerateValue(t *testing.T) {
+	value, err := generateValue("$(random:32)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[a-zA-Z0-9]{32}$`).MatchString(value) {
+		t.Fatal("unexpected random value", value)
+	}
+
+	value, err = generateValue("$(uuid)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(value) {
+		t.Fatal("unexpected uuid", value)
+	}
+
+	for _, generator := range []string{"$(random:0)", "$(random:5000)", "$(uuid:2)", "$(unknown)"} {
+		if _, err := generateValue(generator); err == nil {
+			t.Fatal(generator, "should be invalid")
+		}
+	}
+}
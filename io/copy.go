@@ -80,3 +80,28 @@ func CopyWithTimeout(timeout time.Duration) func(io.Writer, io.Reader) (int64, e
 		return written, err
 	}
 }
+
+// ReaderWithFirstReadChan returns a reader closing the firstReadDone channel
+// once the first read on r has returned. The data are only returned once the
+// hookDone channel is closed, so that they are written after the output of
+// the close hook of the spinner.
+func ReaderWithFirstReadChan(r io.Reader, firstReadDone chan struct{}, hookDone <-chan struct{}) io.Reader {
+	return &firstReadReader{reader: r, firstReadDone: firstReadDone, hookDone: hookDone}
+}
+
+type firstReadReader struct {
+	reader        io.Reader
+	firstReadDone chan struct{}
+	hookDone      <-chan struct{}
+}
+
+func (r *firstReadReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	select {
+	case <-r.firstReadDone:
+	default:
+		close(r.firstReadDone)
+		<-r.hookDone
+	}
+	return n, err
+}
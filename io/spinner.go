@@ -12,6 +12,9 @@ type Spinner struct {
 	stop     chan struct{}
 	writer   io.Writer
 	PostHook func()
+	// Done, if set, is closed once the spinner has stopped and PostHook has
+	// returned
+	Done chan struct{}
 }
 
 func NewSpinner(writer io.Writer) *Spinner {
@@ -33,6 +36,9 @@ func (s *Spinner) Start() {
 			if s.PostHook != nil {
 				s.PostHook()
 			}
+			if s.Done != nil {
+				close(s.Done)
+			}
 			return
 		default:
 		}
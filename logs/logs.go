@@ -56,6 +56,12 @@ func Dump(logsURL string, n int, filter string) error {
 }
 
 func Stream(logsRawURL string, filter string) error {
+	return StreamUntil(logsRawURL, filter, nil)
+}
+
+// StreamUntil streams the logs like Stream, until the user interrupts it or
+// until the stop channel is closed.
+func StreamUntil(logsRawURL string, filter string, stop <-chan struct{}) error {
 	var (
 		err   error
 		event WSEvent
@@ -87,7 +93,11 @@ func Stream(logsRawURL string, filter string) error {
 
 	go func() {
 		defer close(signals)
-		<-signals
+		select {
+		case <-signals:
+		case <-stop:
+			signal.Stop(signals)
+		}
 		err := conn.Close()
 		if err != nil {
 			debug.Println("Fail to close log websocket connection", err)
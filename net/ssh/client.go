@@ -2,6 +2,7 @@ package ssh
 
 import (
 	stdio "io"
+	"net"
 
 	"github.com/Scalingo/cli/config"
 	"github.com/Scalingo/cli/crypto/sshkeys"
@@ -14,11 +15,17 @@ var (
 	ErrNoAuthSucceed = errgo.Newf("No authentication method has succeeded")
 )
 
-func Connect(identity string) (*ssh.Client, ssh.Signer, error) {
+type ConnectOpts struct {
+	Identity string
+	HostKey  HostKeyOpts
+}
+
+func Connect(opts ConnectOpts) (*ssh.Client, ssh.Signer, error) {
 	var (
 		err         error
 		privateKeys []ssh.Signer
 	)
+	identity := opts.Identity
 	if identity == "ssh-agent" {
 		var agentConnection stdio.Closer
 		privateKeys, agentConnection, err = sshkeys.ReadPrivateKeysFromAgent()
@@ -41,7 +48,7 @@ func Connect(identity string) (*ssh.Client, ssh.Signer, error) {
 
 	debug.Println("Identity used:", identity, "Private keys:", len(privateKeys))
 
-	client, key, err := ConnectToSSHServer(privateKeys)
+	client, key, err := ConnectToSSHServer(privateKeys, opts.HostKey)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -49,7 +56,7 @@ func Connect(identity string) (*ssh.Client, ssh.Signer, error) {
 	return client, key, nil
 }
 
-func ConnectToSSHServer(keys []ssh.Signer) (*ssh.Client, ssh.Signer, error) {
+func ConnectToSSHServer(keys []ssh.Signer, hostKeyOpts HostKeyOpts) (*ssh.Client, ssh.Signer, error) {
 	var (
 		client     *ssh.Client
 		privateKey ssh.Signer
@@ -57,9 +64,11 @@ func ConnectToSSHServer(keys []ssh.Signer) (*ssh.Client, ssh.Signer, error) {
 	)
 
 	for _, privateKey = range keys {
-		client, err = ConnectToSSHServerWithKey(privateKey)
+		client, err = ConnectToSSHServerWithKey(privateKey, hostKeyOpts)
 		if err == nil {
 			break
+		} else if _, ok := err.(*HostKeyError); ok {
+			return nil, nil, err
 		} else {
 			config.C.Logger.Println("Fail to connect to the SSH server", err)
 		}
@@ -70,12 +79,25 @@ func ConnectToSSHServer(keys []ssh.Signer) (*ssh.Client, ssh.Signer, error) {
 	return client, privateKey, nil
 }
 
-func ConnectToSSHServerWithKey(key ssh.Signer) (*ssh.Client, error) {
+func ConnectToSSHServerWithKey(key ssh.Signer, hostKeyOpts HostKeyOpts) (*ssh.Client, error) {
 	sshConfig := &ssh.ClientConfig{
-		User:            "git",
-		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		User:              "git",
+		Auth:              []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyAlgorithms: HostKeyAlgorithms(hostKeyOpts, config.C.SshHost),
 	}
 
-	return ssh.Dial("tcp", config.C.SshHost, sshConfig)
+	// The SSH library hides the error of the callback in a generic handshake
+	// error, it is kept aside to be returned as is.
+	var hostKeyErr error
+	checkHostKey := HostKeyCallback(hostKeyOpts)
+	sshConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKeyErr = checkHostKey(hostname, remote, key)
+		return hostKeyErr
+	}
+
+	client, err := ssh.Dial("tcp", config.C.SshHost, sshConfig)
+	if hostKeyErr != nil {
+		return nil, hostKeyErr
+	}
+	return client, err
 }
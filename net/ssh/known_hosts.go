@@ -0,0 +1,318 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	stdio "io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Scalingo/cli/config"
+	"github.com/Scalingo/cli/term"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/errgo.v1"
+)
+
+var (
+	DefaultKnownHostsFile = filepath.Join(config.HomeDir(), ".ssh", "known_hosts")
+)
+
+// HostKeyError is returned when the key presented by the SSH server is
+// rejected, trying to connect with another private key is useless then.
+type HostKeyError struct {
+	msg string
+}
+
+func (err *HostKeyError) Error() string {
+	return err.msg
+}
+
+func hostKeyErrorf(format string, args ...interface{}) error {
+	return &HostKeyError{msg: fmt.Sprintf(format, args...)}
+}
+
+type HostKeyOpts struct {
+	// KnownHostsFile is the file where the known host keys are read and where
+	// the newly accepted keys are written, default is ~/.ssh/known_hosts
+	KnownHostsFile string
+	// InsecureSkipVerify disables any verification of the host key
+	InsecureSkipVerify bool
+}
+
+type knownHost struct {
+	marker string
+	hosts  []string
+	key    ssh.PublicKey
+}
+
+// HostKeyCallback checks the key presented by the SSH server against the
+// known_hosts file. An unknown key is added to the
+// known_hosts file once the user has accepted it, a key which doesn't match
+// the known one is a hard failure.
+func HostKeyCallback(opts HostKeyOpts) ssh.HostKeyCallback {
+	if opts.InsecureSkipVerify {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fmt.Fprintf(os.Stderr, "WARNING: the host key of %s (%s) is not verified\n", hostname, ssh.FingerprintSHA256(key))
+			return nil
+		}
+	}
+
+	knownHostsFile := opts.KnownHostsFile
+	if knownHostsFile == "" {
+		knownHostsFile = DefaultKnownHostsFile
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return checkHostKey(knownHostsFile, knownHostAddress(hostname), key)
+	}
+}
+
+// HostKeyAlgorithms returns the types of the keys known for the host, the
+// server is asked to present a key of one of these types, so that a known key
+// is not missed because the server prefers another algorithm.
+func HostKeyAlgorithms(opts HostKeyOpts, hostname string) []string {
+	if opts.InsecureSkipVerify {
+		return nil
+	}
+	knownHostsFile := opts.KnownHostsFile
+	if knownHostsFile == "" {
+		knownHostsFile = DefaultKnownHostsFile
+	}
+	hosts, err := hostKeys(knownHostsFile)
+	if err != nil {
+		return nil
+	}
+
+	var algorithms []string
+	address := knownHostAddress(hostname)
+	for _, host := range hosts {
+		if host.marker != "" || !host.matches(address) {
+			continue
+		}
+		if !contains(algorithms, host.key.Type()) {
+			algorithms = append(algorithms, host.key.Type())
+		}
+	}
+	return algorithms
+}
+
+func checkHostKey(knownHostsFile, address string, key ssh.PublicKey) error {
+	hosts, err := hostKeys(knownHostsFile)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	var changed *knownHost
+	for _, host := range hosts {
+		if !host.matches(address) {
+			continue
+		}
+		sameKey := bytes.Equal(host.key.Marshal(), key.Marshal())
+		switch {
+		case host.marker == "revoked" && sameKey:
+			return hostKeyErrorf("host key revoked: %s presented the revoked key %s", address, ssh.FingerprintSHA256(key))
+		case host.marker != "":
+			continue
+		case sameKey:
+			return nil
+		case host.key.Type() == key.Type() && changed == nil:
+			h := host
+			changed = &h
+		}
+	}
+
+	if changed != nil {
+		return hostKeyErrorf(
+			"host key changed, someone could be eavesdropping on you (man-in-the-middle attack)!\n"+
+				"The %s key of %s is %s while %s was expected.\n"+
+				"If the key has legitimately changed, remove the entry of %s from %s",
+			key.Type(), address, ssh.FingerprintSHA256(key), ssh.FingerprintSHA256(changed.key), address, knownHostsFile,
+		)
+	}
+
+	return trustOnFirstUse(knownHostsFile, address, key)
+}
+
+func trustOnFirstUse(knownHostsFile, address string, key ssh.PublicKey) error {
+	if config.C.DisableInteractive || !term.IsATTY(os.Stdin) {
+		return hostKeyErrorf(
+			"unknown host key, %s presented the %s key %s, add it to %s (or use --known-hosts) to trust it",
+			address, key.Type(), ssh.FingerprintSHA256(key), knownHostsFile,
+		)
+	}
+
+	fmt.Fprintf(os.Stderr, "The authenticity of host '%s' can't be established.\n", address)
+	fmt.Fprintf(os.Stderr, "%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+	fmt.Fprint(os.Stderr, "Are you sure you want to continue connecting (yes/no)? ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != stdio.EOF {
+		return errgo.Mask(err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "yes" && answer != "y" {
+		return hostKeyErrorf("host key verification failed, key of %s not accepted", address)
+	}
+
+	err = addKnownHost(knownHostsFile, address, key)
+	if err != nil {
+		return errgo.Notef(err, "fail to add the host key to %s", knownHostsFile)
+	}
+	fmt.Fprintf(os.Stderr, "Permanently added '%s' (%s) to the list of known hosts.\n", address, key.Type())
+	return nil
+}
+
+// hostKeys returns the keys of the known_hosts file, a missing file is not an
+// error.
+func hostKeys(knownHostsFile string) ([]knownHost, error) {
+	content, err := ioutil.ReadFile(knownHostsFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errgo.Notef(err, "fail to read %s", knownHostsFile)
+	}
+	hosts, err := parseKnownHosts(content)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid known hosts file %s", knownHostsFile)
+	}
+	return hosts, nil
+}
+
+func parseKnownHosts(content []byte) ([]knownHost, error) {
+	var hosts []knownHost
+	for {
+		marker, patterns, key, _, rest, err := ssh.ParseKnownHosts(content)
+		if err == stdio.EOF {
+			return hosts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, knownHost{marker: marker, hosts: patterns, key: key})
+		content = rest
+	}
+}
+
+func addKnownHost(knownHostsFile, address string, key ssh.PublicKey) error {
+	err := os.MkdirAll(filepath.Dir(knownHostsFile), 0700)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	content, err := ioutil.ReadFile(knownHostsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errgo.Mask(err)
+	}
+	line := address + " " + string(ssh.MarshalAuthorizedKey(key))
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		line = "\n" + line
+	}
+
+	fd, err := os.OpenFile(knownHostsFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	defer fd.Close()
+	_, err = fd.WriteString(line)
+	return errgo.Mask(err)
+}
+
+// matches implements the host patterns of the known_hosts file: hashed
+// hostnames, wildcards and negations.
+func (h knownHost) matches(address string) bool {
+	matched := false
+	for _, pattern := range h.hosts {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if !matchHostPattern(pattern, address) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+func matchHostPattern(pattern, address string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		return matchHashedHost(pattern, address)
+	}
+	return matchWildcard(pattern, address)
+}
+
+// matchWildcard matches the OpenSSH patterns, where '*' matches any sequence
+// of characters and '?' exactly one character.
+func matchWildcard(pattern, value string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(value); i >= 0; i-- {
+				if matchWildcard(pattern[1:], value[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(value) == 0 {
+				return false
+			}
+		default:
+			if len(value) == 0 || pattern[0] != value[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		value = value[1:]
+	}
+	return len(value) == 0
+}
+
+// matchHashedHost checks a hostname hashed by OpenSSH (HashKnownHosts):
+// |1|base64(salt)|base64(HMAC-SHA1(salt, hostname))
+func matchHashedHost(pattern, address string) bool {
+	parts := strings.Split(pattern, "|")
+	if len(parts) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// knownHostAddress formats the address the way known_hosts does: the port is
+// only written, between brackets, when it's not the default one.
+func knownHostAddress(hostname string) string {
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return hostname
+	}
+	if port == "22" {
+		return host
+	}
+	return "[" + host + "]:" + port
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestKey(t *testing.T) ssh.PublicKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func hashHost(host string) string {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestKnownHostMatches(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		address  string
+		expected bool
+	}{
+		{[]string{"scalingo.com"}, "scalingo.com", true},
+		{[]string{"example.com", "scalingo.com"}, "scalingo.com", true},
+		{[]string{"[scalingo.com]:2222"}, "[scalingo.com]:2222", true},
+		{[]string{"scalingo.com"}, "[scalingo.com]:2222", false},
+		{[]string{"*.scalingo.com"}, "ssh.osc-fr1.scalingo.com", true},
+		{[]string{"*.scalingo.com", "!ssh.osc-fr1.scalingo.com"}, "ssh.osc-fr1.scalingo.com", false},
+		{[]string{hashHost("scalingo.com")}, "scalingo.com", true},
+		{[]string{hashHost("scalingo.com")}, "example.com", false},
+	}
+	for _, c := range cases {
+		host := knownHost{hosts: c.patterns}
+		if host.matches(c.address) != c.expected {
+			t.Fatalf("expected %v for %s matching %v", c.expected, c.address, c.patterns)
+		}
+	}
+}
+
+func TestKnownHostAddress(t *testing.T) {
+	if address := knownHostAddress("scalingo.com:22"); address != "scalingo.com" {
+		t.Fatalf("expected scalingo.com, got %s", address)
+	}
+	if address := knownHostAddress("scalingo.com:2222"); address != "[scalingo.com]:2222" {
+		t.Fatalf("expected [scalingo.com]:2222, got %s", address)
+	}
+}
+
+func TestCheckHostKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+
+	key := newTestKey(t)
+	err = addKnownHost(knownHostsFile, "scalingo.com", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkHostKey(knownHostsFile, "scalingo.com", key)
+	if err != nil {
+		t.Fatalf("known key should be accepted: %v", err)
+	}
+
+	err = checkHostKey(knownHostsFile, "scalingo.com", newTestKey(t))
+	if _, ok := err.(*HostKeyError); !ok {
+		t.Fatalf("changed key should be rejected, got %v", err)
+	}
+}
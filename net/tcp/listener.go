@@ -0,0 +1,75 @@
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/Scalingo/cli/debug"
+	"gopkg.in/errgo.v1"
+)
+
+// ConnHandler handles a connection accepted by Serve, id is unique among the
+// connections accepted by the process.
+type ConnHandler func(id int, conn *net.TCPConn)
+
+var (
+	connIDGenerator      = make(chan int)
+	startIDGeneratorOnce = &sync.Once{}
+)
+
+// Listen binds a TCP socket on localhost. If the port is already in use, the
+// following ones are tried until a free port is found.
+func Listen(port int) (*net.TCPListener, error) {
+	for {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+
+		sock, err := net.ListenTCP("tcp", tcpAddr)
+		if isAddrInUse(err) {
+			port++
+			continue
+		}
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		return sock, nil
+	}
+}
+
+// Serve accepts the connections of the listener and handles each of them in
+// its own goroutine. It only returns when the listener fails to accept a
+// connection, for instance when it has been closed.
+func Serve(sock *net.TCPListener, handler ConnHandler) error {
+	startIDGeneratorOnce.Do(func() {
+		go startIDGenerator()
+	})
+	for {
+		debug.Println("Waiting local connection request")
+		conn, err := sock.AcceptTCP()
+		if err != nil {
+			return errgo.Mask(err, errgo.Any)
+		}
+		debug.Println("New local connection")
+		go handler(<-connIDGenerator, conn)
+	}
+}
+
+func startIDGenerator() {
+	for i := 1; ; i++ {
+		connIDGenerator <- i
+	}
+}
+
+func isAddrInUse(err error) bool {
+	if err, ok := err.(*net.OpError); ok {
+		if err, ok := err.Err.(*os.SyscallError); ok {
+			return err.Err == syscall.EADDRINUSE
+		}
+	}
+	return false
+}
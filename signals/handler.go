@@ -4,11 +4,16 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 )
 
 var (
 	CatchQuitSignals = true
+
+	cleanupsMutex sync.Mutex
+	cleanups      = map[int]func(){}
+	cleanupsID    int
 )
 
 func Handle() {
@@ -17,7 +22,32 @@ func Handle() {
 	for sig := range signals {
 		if CatchQuitSignals {
 			fmt.Printf("%v catched, aborting…\n", sig)
+			runCleanups()
 			os.Exit(-127)
 		}
 	}
 }
+
+// OnQuit registers a function called before the CLI exits because of a quit
+// signal, for instance to remove a lock file. The returned function
+// unregisters it.
+func OnQuit(cleanup func()) func() {
+	cleanupsMutex.Lock()
+	defer cleanupsMutex.Unlock()
+	cleanupsID++
+	id := cleanupsID
+	cleanups[id] = cleanup
+	return func() {
+		cleanupsMutex.Lock()
+		defer cleanupsMutex.Unlock()
+		delete(cleanups, id)
+	}
+}
+
+func runCleanups() {
+	cleanupsMutex.Lock()
+	defer cleanupsMutex.Unlock()
+	for _, cleanup := range cleanups {
+		cleanup()
+	}
+}
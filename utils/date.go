@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/errgo.v1"
+)
+
+// ParseDate parses the dates given in the command line, either a day
+// (YYYY-MM-DD), a day and a time (YYYY-MM-DD HH:MM) in the local time zone,
+// or a RFC3339 timestamp.
+func ParseDate(date string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, date)
+	if err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04"} {
+		t, err := time.ParseInLocation(layout, date, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errgo.Newf("invalid date '%s', expected YYYY-MM-DD, 'YYYY-MM-DD HH:MM' or RFC3339", date)
+}
+
+// ParseDuration parses the durations given in the command line, in days
+// (30d) or with the units of time.ParseDuration (12h, 90m)
+func ParseDuration(duration string) (time.Duration, error) {
+	if strings.HasSuffix(duration, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(duration, "d"))
+		if err == nil && days >= 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(duration); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, errgo.Newf("invalid duration '%s', expected a number of days like 30d, or hours like 12h", duration)
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	durations := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"0d":  0,
+		"12h": 12 * time.Hour,
+	}
+	for s, expected := range durations {
+		d, err := ParseDuration(s)
+		if err != nil {
+			t.Fatal(s, "should be valid, got", err)
+		}
+		if d != expected {
+			t.Fatal("expected", expected, "for", s, "got", d)
+		}
+	}
+
+	for _, s := range []string{"", "d", "-2d", "30 days", "-1h"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Fatal(s, "should be invalid")
+		}
+	}
+}